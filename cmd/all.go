@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jharshman/fwsync/config"
+	"github.com/jharshman/fwsync/internal/transaction"
+)
+
+// target is a profile updated by update --all along with the outcome of syncing its firewall.
+type target struct {
+	profile string
+	config  *config.Config
+	// whether a new IP was added to the profile.
+	added bool
+	// expired IPs pruned from the profile.
+	pruned []string
+	// whether the dry run found changes to apply.
+	pending bool
+	// change applied to the firewall, if it was synced.
+	change *config.Change
+	status string
+	err    error
+}
+
+// updateAll adds the current public IPs to every profile in ~/.fwsync, prunes their expired IPs and syncs their
+// firewalls concurrently, each with its own timeout. A summary of every profile is printed once all firewalls are done.
+func updateAll(timeout time.Duration, dryRun, overwrite, allowUnsafe bool, label, note string) error {
+	file, err := loadFile()
+	if err != nil {
+		return err
+	}
+
+	// IPv4 and, on dual-stack networks, IPv6.
+	currentIPs, err := publicIPs(file, allowUnsafe)
+	if err != nil {
+		return err
+	}
+
+	names := file.Names()
+	targets := make([]*target, 0, len(names))
+	for _, name := range names {
+		t := &target{profile: name, config: file.Profiles[name]}
+		t.added, t.pruned, t.err = t.config.Refresh(currentIPs, label, note)
+		targets = append(targets, t)
+	}
+
+	// write the new and seen IPs before syncing, like update does for a single profile.
+	if !dryRun {
+		if err := save(file); err != nil {
+			return err
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		if t.err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.sync(timeout, dryRun, overwrite)
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	pending := false
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROFILE\tPROVIDER\tFIREWALL\tSTATUS")
+	for _, t := range targets {
+		status := t.status
+		if t.err != nil {
+			failed++
+			status = fmt.Sprintf("failed: %v", t.err)
+		}
+		pending = pending || t.pending
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.profile, t.config.Provider, t.config.Name, status)
+	}
+	w.Flush()
+
+	if !dryRun {
+		// record the ranges now managed on each synced firewall.
+		if err := save(file); err != nil {
+			return err
+		}
+		var changes []config.Change
+		for _, t := range targets {
+			if t.change != nil {
+				changes = append(changes, *t.change)
+			}
+		}
+		if err := record(changes...); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d firewalls failed to update", failed, len(targets))
+	}
+	if pending {
+		return &ExitError{Code: ExitCodeChangesPending}
+	}
+	return nil
+}
+
+// sync syncs the target's firewall if a new IP was added to its profile or an expired IP pruned from it.
+// With dryRun the changes are only counted. The outcome is recorded in the target's status and err.
+func (t *target) sync(timeout time.Duration, dryRun, overwrite bool) {
+	if !t.added && len(t.pruned) == 0 {
+		t.status = "up-to-date"
+		return
+	}
+
+	client, err := t.config.AuthForProvider()
+	if err != nil {
+		t.err = err
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if dryRun {
+		changes, err := pending(ctx, client, t.config, overwrite)
+		if err != nil {
+			t.err = err
+			return
+		}
+		t.pending = changes.Pending()
+		t.status = fmt.Sprintf("%d to add, %d to remove", len(changes.Added), len(changes.Removed))
+		return
+	}
+
+	change, err := synchronize(ctx, client, t.config, overwrite)
+	if err != nil {
+		t.err = err
+		return
+	}
+	t.change = &change
+	t.status = "updated"
+}
+
+// syncAll syncs the firewalls of every profile in ~/.fwsync as a single transaction. Every firewall is read
+// before any is written. If one firewall fails to sync, the firewalls synced before it are restored to what
+// they were and reported. With dryRun the plan of every profile is printed instead.
+func syncAll(dryRun, overwrite bool) error {
+	file, err := loadFile()
+	if err != nil {
+		return err
+	}
+
+	names := file.Names()
+	targets := make([]transaction.Target, 0, len(names))
+	for _, name := range names {
+		cfg := file.Profiles[name]
+		client, err := cfg.AuthForProvider()
+		if err != nil {
+			return fmt.Errorf("profile: %s: %w", name, err)
+		}
+		targets = append(targets, syncTarget(cfg, client, overwrite))
+	}
+
+	if dryRun {
+		var exitErr error
+		for _, t := range targets {
+			fmt.Printf("profile: %s\n", t.Name)
+			err := plan(t.Provider, file.Profiles[t.Name], overwrite)
+			if errors.As(err, new(*ExitError)) {
+				exitErr = err
+			} else if err != nil {
+				return err
+			}
+			fmt.Println()
+		}
+		return exitErr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout*time.Duration(len(targets)))
+	defer cancel()
+
+	fmt.Println("syncing firewall rules")
+	applied, err := transaction.Apply(ctx, targets)
+	var txErr *transaction.Error
+	if errors.As(err, &txErr) {
+		printRollback(txErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	changes := make([]config.Change, 0, len(applied))
+	for _, a := range applied {
+		cfg := file.Profiles[a.Target]
+		changes = append(changes, appliedChange(cfg, a))
+		cfg.Managed = cfg.IPs()
+	}
+	if err := save(file); err != nil {
+		return err
+	}
+	return record(changes...)
+}
+
+func printRollback(txErr *transaction.Error) {
+	fmt.Printf("profile: %s failed to sync: %v\n", txErr.Target, txErr.Err)
+	if len(txErr.RolledBack) == 0 {
+		fmt.Println("no firewalls were changed.")
+		return
+	}
+
+	fmt.Println("rolled back:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, r := range txErr.RolledBack {
+		if r.Err != nil {
+			fmt.Fprintf(w, "  %s\tFAILED: %v\n", r.Target, r.Err)
+			continue
+		}
+		fmt.Fprintf(w, "  %s\trestored to %v\n", r.Target, r.Ranges)
+	}
+	w.Flush()
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Allow adds an IP to the firewall rule, e.g. a colleague's IP or a conference network. With --for the IP
+// is only allowed temporarily, it is removed by the first update or prune after the grant expired.
+func Allow() *cobra.Command {
+	var dryRun bool
+	var overwrite bool
+	var profile string
+	var duration time.Duration
+	var label string
+	var note string
+
+	allowCmd := &cobra.Command{
+		SilenceErrors: true, // errors are always propogated to main, no need to print again
+		Use:           "allow <ip>",
+		Short:         "Allow an IP on the firewall, optionally for a limited time.",
+		Args:          cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if duration < 0 {
+				return fmt.Errorf("invalid --for: %s, must not be negative", duration)
+			}
+
+			// get local configuration
+			file, cfg, err := loadProfile(profile)
+			if err != nil {
+				return err
+			}
+
+			ip, err := cfg.Normalize(args[0])
+			if err != nil {
+				return err
+			}
+			if err := cfg.Allow(ip, duration); err != nil {
+				return err
+			}
+			entry := cfg.Entry(ip)
+			if entry == nil {
+				return fmt.Errorf("IP: %s not found in profile: %s", ip, cfg.Profile)
+			}
+			if label != "" {
+				entry.Label = label
+			}
+			if note != "" {
+				entry.Note = note
+			}
+
+			if entry.ExpiresAt.IsZero() {
+				fmt.Printf("allowing %s\n", entry.IP)
+			} else {
+				fmt.Printf("allowing %s until %s\n", entry.IP, entry.ExpiresAt.Local().Format(time.DateTime))
+			}
+			return syncProfile(file, cfg, dryRun, overwrite)
+		},
+	}
+	profileFlag(allowCmd, &profile)
+	allowCmd.Flags().DurationVar(&duration, "for", 0,
+		"Remove the IP once this long has passed, e.g. 2h. The IP does not expire if 0")
+	allowCmd.Flags().StringVar(&label, "label", "", "Label the IP, e.g. the name of a colleague")
+	allowCmd.Flags().StringVar(&note, "note", "", "Attach a note to the IP")
+	allowCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the changes without writing the configuration or syncing the firewall")
+	overwriteFlag(allowCmd, &overwrite)
+	return allowCmd
+}
+
+// Revoke removes an IP from the firewall rule, e.g. to end a temporary grant early.
+func Revoke() *cobra.Command {
+	var dryRun bool
+	var overwrite bool
+	var profile string
+
+	revokeCmd := &cobra.Command{
+		SilenceErrors: true, // errors are always propogated to main, no need to print again
+		Use:           "revoke <ip>",
+		Short:         "Remove an IP from the firewall.",
+		Args:          cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// get local configuration
+			file, cfg, err := loadProfile(profile)
+			if err != nil {
+				return err
+			}
+
+			entry := cfg.Entry(args[0])
+			if entry == nil {
+				return fmt.Errorf("IP: %s not found in profile: %s", args[0], cfg.Profile)
+			}
+			fmt.Printf("revoking %s\n", entry.IP)
+			cfg.Remove(entry.IP)
+			return syncProfile(file, cfg, dryRun, overwrite)
+		},
+	}
+	profileFlag(revokeCmd, &profile)
+	revokeCmd.Flags().BoolVar(&dryRun, "dry-run", false,
+		"Show the changes without writing the configuration or syncing the firewall")
+	overwriteFlag(revokeCmd, &overwrite)
+	return revokeCmd
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jharshman/fwsync/config"
+	"github.com/spf13/cobra"
+)
+
+// allowUnsafeFlag registers the --allow-unsafe-ip flag on cmd.
+func allowUnsafeFlag(cmd *cobra.Command, allowUnsafe *bool) {
+	cmd.Flags().BoolVar(allowUnsafe, "allow-unsafe-ip", false,
+		"Allow public IPs only detected through an HTTP proxy or shared through carrier-grade NAT")
+}
+
+// publicIPs detects the current public IPs with the resolvers configured in file and prints any warnings about them.
+// IPs unsafe to allow on a firewall, e.g. only detected through an HTTP proxy or shared through carrier-grade NAT,
+// are refused unless allowUnsafe is set. An error is returned if every IP was refused.
+func publicIPs(file *config.File, allowUnsafe bool) ([]string, error) {
+	detections, err := file.DetectPublicIPs()
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]string, 0, len(detections))
+	for _, d := range detections {
+		printWarnings(d)
+		if d.Unsafe() && !allowUnsafe {
+			fmt.Fprintf(os.Stderr, "refusing to allow %s, pass --allow-unsafe-ip to allow it anyway\n", d.IP)
+			continue
+		}
+		ips = append(ips, d.IP)
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("no public IP is safe to allow, pass --allow-unsafe-ip to allow it anyway")
+	}
+	return ips, nil
+}
+
+// printWarnings prints the warnings about a detected public IP to stderr.
+func printWarnings(d config.Detection) {
+	for _, w := range d.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s: %s\n", d.IP, w.Message)
+	}
+}
@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jharshman/fwsync/config"
+	"github.com/jharshman/fwsync/internal/providers/generic"
+	"github.com/spf13/cobra"
+)
+
+// History lists the changes fwsync applied to firewalls, most recent first.
+func History() *cobra.Command {
+	var profile string
+
+	historyCmd := &cobra.Command{
+		SilenceErrors: true, // errors are always propogated to main, no need to print again
+		Use:           "history",
+		Short:         "Display changes applied to your firewalls.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			history, err := loadHistory()
+			if err != nil {
+				return err
+			}
+
+			changes := recent(history, profile)
+			if len(changes) == 0 {
+				fmt.Println("No changes recorded.")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "N\tTIME\tPROFILE\tPROVIDER\tFIREWALL\tCHANGES")
+			for i, c := range changes {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+					i+1, c.Time.Local().Format(time.DateTime), c.Profile, c.Provider, c.Firewall, summarize(c))
+			}
+			return w.Flush()
+		},
+	}
+	profileFlag(historyCmd, &profile)
+	return historyCmd
+}
+
+// Rollback restores a firewall to how it was before the Nth most recent change listed by history.
+// The source IPs in the local configuration are left untouched, but the ranges fwsync managed before the
+// change are recorded as managed again so later syncs remove them once they are no longer wanted.
+func Rollback() *cobra.Command {
+	var profile string
+	var yes bool
+
+	rollbackCmd := &cobra.Command{
+		SilenceErrors: true, // errors are always propogated to main, no need to print again
+		Use:           "rollback [N]",
+		Short:         "Undo a change applied to a firewall.",
+		Args:          cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n := 1
+			if len(args) == 1 {
+				var err error
+				if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+					return fmt.Errorf("invalid change number: %s", args[0])
+				}
+			}
+
+			history, err := loadHistory()
+			if err != nil {
+				return err
+			}
+			changes := recent(history, profile)
+			if n > len(changes) {
+				return fmt.Errorf("no change number %d, %d changes recorded", n, len(changes))
+			}
+			change := changes[n-1]
+
+			file, err := loadFile()
+			if err != nil {
+				return err
+			}
+			cfg, ok := file.Profiles[change.Profile]
+			if !ok || cfg.Provider != change.Provider || cfg.Name != change.Firewall {
+				return fmt.Errorf("profile: %s no longer manages firewall: %s", change.Profile, change.Firewall)
+			}
+
+			client, err := cfg.AuthForProvider()
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+			defer cancel()
+
+			fw, err := client.Get(ctx, cfg.Name)
+			if err != nil {
+				return err
+			}
+			current := generic.FromWire(remoteRanges(fw))
+			diff := generic.Diff(current, change.Previous)
+			printPlan(cfg.Name, diff)
+			if !diff.Pending() {
+				return nil
+			}
+
+			if !yes {
+				_, ok := ask("Restore the firewall? [Y/n]: ", true, func(val string) bool {
+					switch val {
+					case "Y", "y", "yes", "":
+						return true
+					}
+					return false
+				})
+				if !ok {
+					return nil
+				}
+			}
+
+			if len(change.Previous) == 0 {
+				return fmt.Errorf("firewall: %s: %w", cfg.Name, generic.ErrNoRanges)
+			}
+
+			// the firewall must still be as displayed in the plan.
+			wire := generic.ToWire(change.Previous, client.AddressFormat())
+			if conditional, ok := client.(generic.ConditionalUpdater); ok {
+				err = conditional.UpdateIfUnchanged(ctx, fw, wire)
+			} else {
+				err = client.Update(ctx, cfg.Name, wire)
+			}
+			if errors.Is(err, generic.ErrConflict) {
+				return fmt.Errorf("%w, run rollback again to review the changes", err)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("restored firewall %s\n", cfg.Name)
+
+			// the rollback is a change of its own so it can be undone as well.
+			rollback := config.Change{
+				Time:            time.Now().UTC(),
+				Profile:         cfg.Profile,
+				Provider:        cfg.Provider,
+				Firewall:        cfg.Name,
+				Previous:        current,
+				Current:         change.Previous,
+				PreviousManaged: slices.Clone(cfg.Owned()),
+			}
+			cfg.Restored(change)
+			if err := save(file); err != nil {
+				return err
+			}
+			return record(rollback)
+		},
+	}
+	profileFlag(rollbackCmd, &profile)
+	rollbackCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Restore the firewall without asking for confirmation")
+	return rollbackCmd
+}
+
+// recent returns the recorded changes, most recent first. Only the changes of the given profile
+// are returned, unless profile is empty.
+func recent(history *config.History, profile string) []config.Change {
+	changes := make([]config.Change, 0, len(history.Changes))
+	for i := len(history.Changes) - 1; i >= 0; i-- {
+		if profile != "" && history.Changes[i].Profile != profile {
+			continue
+		}
+		changes = append(changes, history.Changes[i])
+	}
+	return changes
+}
+
+// summarize describes a change as the ranges it added and removed.
+func summarize(change config.Change) string {
+	diff := generic.Diff(change.Previous, change.Current)
+	parts := make([]string, 0, len(diff.Added)+len(diff.Removed))
+	for _, r := range diff.Added {
+		parts = append(parts, "+"+r)
+	}
+	for _, r := range diff.Removed {
+		parts = append(parts, "-"+r)
+	}
+	if len(parts) == 0 {
+		return "no changes"
+	}
+	return strings.Join(parts, " ")
+}
+
+// loadHistory reads ~/.fwsync_history. A missing file holds no changes.
+func loadHistory() (*config.History, error) {
+	f, err := os.Open(historyFilePath)
+	if os.IsNotExist(err) {
+		return &config.History{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return config.LoadHistory(f)
+}
+
+// record adds the changes to ~/.fwsync_history.
+func record(changes ...config.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	history, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		history.Record(c)
+	}
+
+	f, err := os.Create(historyFilePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return history.Write(f)
+}
@@ -8,26 +8,41 @@ import (
 	"time"
 
 	"github.com/jharshman/fwsync/config"
+	"github.com/jharshman/fwsync/internal/providers/generic"
 	"github.com/spf13/cobra"
 )
 
 const (
 	transactionFile = ".fwsync"
+	historyFile     = ".fwsync_history"
 )
 
 var (
-	home, _     = os.UserHomeDir()
-	cfgFilePath = fmt.Sprintf("%s/%s", home, transactionFile)
+	home, _         = os.UserHomeDir()
+	cfgFilePath     = fmt.Sprintf("%s/%s", home, transactionFile)
+	historyFilePath = fmt.Sprintf("%s/%s", home, historyFile)
 )
 
 // Initialize performs the first sync of the firewall rule. It will prompt the user to select
 // the firewall rule with his or her name and then will update that firewall rule with their current
-// public IP. Any existing source IPs on the firewall rule will be overwritten.
+// public IP. Existing source IPs on the firewall rule are kept unless --overwrite is set.
+// The configuration is stored as a profile, other profiles in ~/.fwsync are left untouched.
 func Initialize() *cobra.Command {
+	var file *config.File
 	var local *config.Config
+	var client generic.Provider
+	var profile string
 	var cloudProvider string
 	var cloudProject string
+	var cloudRegion string
+	var cloudSubscription string
+	var cloudResourceGroup string
 	var ipLimit int
+	var ipv6Prefix int
+	var maxAge time.Duration
+	var dryRun bool
+	var overwrite bool
+	var allowUnsafe bool
 
 	initCmd := &cobra.Command{
 		SilenceErrors: true, // errors are always propogated to main, no need to print again
@@ -39,13 +54,32 @@ func Initialize() *cobra.Command {
 				return fmt.Errorf("the provider: %s requires the --project argument", config.ProviderGoogle)
 			}
 
-			cfg := config.New(
+			if (cloudSubscription == "" || cloudResourceGroup == "") && cloudProvider == config.ProviderAzure {
+				return fmt.Errorf("the provider: %s requires the --subscription and --resource-group arguments", config.ProviderAzure)
+			}
+
+			if ipv6Prefix < 1 || ipv6Prefix > 128 {
+				return fmt.Errorf("invalid --ipv6-prefix: %d, must be between 1 and 128", ipv6Prefix)
+			}
+
+			if maxAge < 0 {
+				return fmt.Errorf("invalid --max-age: %s, must not be negative", maxAge)
+			}
+
+			cfg, err := config.New(
 				config.WithProvider(cloudProvider),
 				config.WithProject(cloudProject),
-				config.WithIPLimit(ipLimit))
+				config.WithRegion(cloudRegion),
+				config.WithSubscription(cloudSubscription),
+				config.WithResourceGroup(cloudResourceGroup),
+				config.WithIPLimit(ipLimit),
+				config.WithIPv6Prefix(ipv6Prefix),
+				config.WithMaxAge(maxAge))
+			if err != nil {
+				return err
+			}
 
-			var err error
-			FirewallClient, err = cfg.AuthForProvider()
+			client, err = cfg.AuthForProvider()
 			if err != nil {
 				return err
 			}
@@ -53,68 +87,104 @@ func Initialize() *cobra.Command {
 			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 			defer cancel()
 
-			firewalls, err := FirewallClient.List(ctx)
+			firewalls, err := client.List(ctx)
 			if err != nil {
 				return err
 			}
 
-			for idx, fw := range firewalls {
-				fmt.Printf("%d:\t%s\n", idx, fw.Name)
+			if len(firewalls) == 0 {
+				return fmt.Errorf("no firewalls found for provider: %s", cloudProvider)
 			}
 
-		ASK:
-			selection, ok := ask(fmt.Sprintf("Select Firewall to use 0-%d: ", len(firewalls)), false, func(val string) bool {
-				i, err := strconv.Atoi(val)
-				if err != nil {
-					return false
+			names := make([]string, 0, len(firewalls))
+			for _, fw := range firewalls {
+				names = append(names, fw.Name)
+			}
+			fwSelection := choose("Firewall", names)
+			cfg.Name = firewalls[fwSelection].Name
+
+			// Some providers manage a single rule out of several on the selected firewall.
+			if rules := firewalls[fwSelection].Rules; rules != nil {
+				if len(rules) == 0 {
+					return fmt.Errorf("firewall: %s has no inbound rules", cfg.Name)
 				}
-				if i >= len(firewalls) || i < 0 {
-					return false
+				cfg.Rule = rules[choose("Rule", rules)]
+				// the rule is found by its name on every sync, so the name must identify it.
+				named := 0
+				for _, rule := range rules {
+					if rule == cfg.Rule {
+						named++
+					}
+				}
+				if cfg.Rule == "" || named > 1 {
+					return fmt.Errorf("rule: %q of firewall: %s is not uniquely named, "+
+						"name it in the console and run init again", cfg.Rule, cfg.Name)
 				}
 
-				_, ok := ask(fmt.Sprintf("You've selected %s, is that correct? [Y/n]: ", firewalls[i].Name), true, func(val string) bool {
-					switch val {
-					case "Y", "y", "yes", "":
-					case "N", "n", "no":
-						return false
-					default:
-						return false
-					}
-					return true
-				})
-				return ok
-			})
-			if !ok {
-				goto ASK
+				// re-authenticate so the client targets the selected rule.
+				client, err = cfg.AuthForProvider()
+				if err != nil {
+					return err
+				}
 			}
 
-			fwSelection, err := strconv.Atoi(selection)
+			// unsafe IPs are refused like on update, rather than initializing a profile without IPs.
+			ips, err := publicIPs(file, allowUnsafe)
 			if err != nil {
 				return err
 			}
-
-			ip, _ := config.PublicIP()
-			fmt.Printf("IP determined to be: %s\n", ip)
-			cfg.Name = firewalls[fwSelection].Name
-			cfg.SourceIPs = []string{ip}
+			for _, ip := range ips {
+				fmt.Printf("IP determined to be: %s\n", ip)
+			}
+			if _, err := cfg.AddCurrent(ips); err != nil {
+				return err
+			}
 
 			local = cfg
 
-			// write file
-			f, err := os.Create(cfgFilePath)
-			if err != nil && !os.IsExist(err) {
-				return err
+			// leave any existing configuration file untouched, PostRunE will print the plan.
+			if dryRun {
+				return nil
 			}
-			defer f.Close()
-			return cfg.Write(f)
+
+			// write file
+			file.Set(profile, cfg)
+			return save(file)
 		},
 		PreRunE: func(cmd *cobra.Command, args []string) error {
-			if _, err := os.Stat(cfgFilePath); err != nil {
-				// config file doesn't exist, continue to RunE to go through creation.
+			if ipLimit < 1 {
+				return fmt.Errorf("invalid --ip-limit: %d, must be at least 1", ipLimit)
+			}
+
+			file = config.NewFile()
+			f, err := os.Open(cfgFilePath)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if err == nil {
+				defer f.Close()
+				if file, err = config.LoadFile(f); err != nil {
+					return err
+				}
+			}
+
+			if profile == "" {
+				profile = file.Default
+			}
+			if profile == "" {
+				profile = config.DefaultProfile
+			}
+
+			if dryRun {
+				// nothing will be written, no need to prompt.
 				return nil
 			}
-			// prompt to nuke existing configuration file.
-			ask("Existing configuration file detected. Continue anyway? [Y/n]: ", false, func(val string) bool {
+			if _, exists := file.Profiles[profile]; !exists {
+				// new profile, continue to RunE to go through creation. Other profiles are left untouched.
+				return nil
+			}
+			// prompt to nuke existing profile.
+			ask(fmt.Sprintf("Existing profile %s detected. Continue anyway? [Y/n]: ", profile), false, func(val string) bool {
 				switch val {
 				case "Y", "y", "yes", "":
 				case "N", "n", "no":
@@ -127,17 +197,77 @@ func Initialize() *cobra.Command {
 			return nil
 		},
 		PostRunE: func(cmd *cobra.Command, args []string) error {
+			if dryRun {
+				return plan(client, local, overwrite)
+			}
 			fmt.Println("syncing firewall rule")
-			return synchronize(local)
+
+			ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+			defer cancel()
+			change, err := synchronize(ctx, client, local, overwrite)
+			if err != nil {
+				return err
+			}
+			if err := save(file); err != nil {
+				return err
+			}
+			return record(change)
 		},
 	}
+	profileFlag(initCmd, &profile)
 	initCmd.Flags().StringVar(&cloudProvider, "provider", "", "Cloud Provider")
 	initCmd.Flags().StringVar(&cloudProject, "project", "", "Cloud Project")
+	initCmd.Flags().StringVar(&cloudRegion, "region", "", "Cloud Region")
+	initCmd.Flags().StringVar(&cloudSubscription, "subscription", "", "Cloud Subscription")
+	initCmd.Flags().StringVar(&cloudResourceGroup, "resource-group", "", "Cloud Resource Group")
 	initCmd.Flags().IntVar(&ipLimit, "ip-limit", 5, "IP Limit")
+	initCmd.Flags().IntVar(&ipv6Prefix, "ipv6-prefix", 128, "Prefix length to allow for IPv6 addresses")
+	initCmd.Flags().DurationVar(&maxAge, "max-age", 0,
+		"Remove IPs not seen for this long, e.g. 168h. IPs never expire with age if 0")
+	initCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the changes without writing the configuration or syncing the firewall")
+	overwriteFlag(initCmd, &overwrite)
+	allowUnsafeFlag(initCmd, &allowUnsafe)
 	initCmd.MarkFlagRequired("provider")
 	return initCmd
 }
 
+// choose prints the numbered options and prompts the user to select and confirm one of them.
+// It returns the index of the selected option.
+func choose(kind string, options []string) int {
+	for idx, opt := range options {
+		fmt.Printf("%d:\t%s\n", idx, opt)
+	}
+
+ASK:
+	selection, ok := ask(fmt.Sprintf("Select %s to use 0-%d: ", kind, len(options)-1), false, func(val string) bool {
+		i, err := strconv.Atoi(val)
+		if err != nil {
+			return false
+		}
+		if i >= len(options) || i < 0 {
+			return false
+		}
+
+		_, ok := ask(fmt.Sprintf("You've selected %s, is that correct? [Y/n]: ", options[i]), true, func(val string) bool {
+			switch val {
+			case "Y", "y", "yes", "":
+			case "N", "n", "no":
+				return false
+			default:
+				return false
+			}
+			return true
+		})
+		return ok
+	})
+	if !ok {
+		goto ASK
+	}
+
+	i, _ := strconv.Atoi(selection)
+	return i
+}
+
 func ask(prompt string, skipRetry bool, check func(val string) bool) (string, bool) {
 	var answer string
 PROMPT:
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/jharshman/fwsync/config"
@@ -13,47 +14,43 @@ import (
 
 // List prints out the current source IPs configured in ~/.fwsync and the source IPs active on the GCP Firewall.
 func List() *cobra.Command {
-	return &cobra.Command{
+	var profile string
+
+	listCmd := &cobra.Command{
 		SilenceErrors: true, // errors are always propogated to main, no need to print again
 		Use:           "list",
 		Short:         "Display your firewall's allowed IPs.",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// get local configured ips
-			home, _ := os.UserHomeDir()
-			f, err := os.Open(fmt.Sprintf("%s/%s", home, transactionFile))
-			if err != nil {
-				return err
-			}
-			defer f.Close()
-
-			cfg, err := config.LoadFromFile(f)
+			_, cfg, err := loadProfile(profile)
 			if err != nil {
 				return err
 			}
 
-			FirewallClient, err = cfg.AuthForProvider()
+			client, err := cfg.AuthForProvider()
 			if err != nil {
 				return err
 			}
 
-			localIPs := cfg.SourceIPs
-
 			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 			defer cancel()
 
 			// get configured fw ips
-			fw, err := FirewallClient.Get(ctx, cfg.Name)
+			fw, err := client.Get(ctx, cfg.Name)
 			if err != nil {
 				return err
 			}
-			remoteIPs := fw.AllowedIPv4Addresses
+			remoteIPs := append(fw.AllowedIPv4Addresses, fw.AllowedIPv6Addresses...)
 
 			// pretty print
-			fmt.Printf("fwsync configurations\n----------------------\nlocal: (%s)\n%s", f.Name(), prettyPrint(localIPs))
+			fmt.Printf("fwsync configurations\n----------------------\nlocal: (%s)\n", cfgFilePath)
+			printEntries(cfg.SourceIPs)
 			fmt.Printf("\nremote: (%s)\n%s", cfg.Name, prettyPrint(remoteIPs))
 			return nil
 		},
 	}
+	profileFlag(listCmd, &profile)
+	return listCmd
 }
 
 // GetCurrentIP will return the current IP and print it to standard out.
@@ -65,13 +62,59 @@ func GetCurrentIP() *cobra.Command {
 		Use:           "get-ip",
 		Short:         "Fetches your current public IP.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			currentIP, err := config.PublicIP()
-			fmt.Printf("current public IP: %s\n", currentIP)
+			// the resolvers configured in ~/.fwsync are used if it exists.
+			file, err := loadFile()
+			if os.IsNotExist(err) {
+				file, err = config.NewFile(), nil
+			}
+			if err != nil {
+				return err
+			}
+
+			detections, err := file.DetectPublicIPs()
+			for _, d := range detections {
+				printWarnings(d)
+				if d.Unsafe() {
+					fmt.Printf("current public IP: %s (unsafe to allow)\n", d.IP)
+					continue
+				}
+				fmt.Printf("current public IP: %s\n", d.IP)
+			}
 			return err
 		},
 	}
 }
 
+// printEntries prints the source IPs along with their metadata.
+func printEntries(entries []config.Entry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IP\tLABEL\tADDED\tLAST SEEN\tEXPIRES\tPINNED\tNOTE")
+	for _, e := range entries {
+		pinned := "-"
+		if e.Pinned {
+			pinned = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.IP, orDash(e.Label),
+			formatTime(e.AddedAt), formatTime(e.LastSeenAt), formatTime(e.ExpiresAt), pinned, orDash(e.Note))
+	}
+	w.Flush()
+}
+
+// formatTime formats t in local time, unknown times are printed as a dash.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
 func prettyPrint(in []string) string {
 	builder := strings.Builder{}
 	for _, v := range in {
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// Pin marks an IP so it is never evicted to make room for new IPs, e.g. an office's static IP.
+func Pin() *cobra.Command {
+	return pinCommand(true)
+}
+
+// Unpin lets an IP be evicted to make room for new IPs again.
+func Unpin() *cobra.Command {
+	return pinCommand(false)
+}
+
+// pinCommand builds the pin or unpin command. Pinning only changes the local configuration,
+// the firewall is left untouched.
+func pinCommand(pinned bool) *cobra.Command {
+	var profile string
+
+	pinCmd := &cobra.Command{
+		SilenceErrors: true, // errors are always propogated to main, no need to print again
+		Use:           "pin <ip>",
+		Short:         "Never evict an IP to make room for new IPs.",
+		Args:          cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// get local configuration
+			file, cfg, err := loadProfile(profile)
+			if err != nil {
+				return err
+			}
+
+			entry := cfg.Entry(args[0])
+			if entry == nil {
+				return fmt.Errorf("IP: %s not found in profile: %s", args[0], cfg.Profile)
+			}
+			entry.Pinned = pinned
+			if err := save(file); err != nil {
+				return err
+			}
+			if pinned {
+				fmt.Printf("pinned %s\n", entry.IP)
+			} else {
+				fmt.Printf("unpinned %s\n", entry.IP)
+			}
+			return nil
+		},
+	}
+	if !pinned {
+		pinCmd.Use = "unpin <ip>"
+		pinCmd.Short = "Allow an IP to be evicted to make room for new IPs."
+	}
+	profileFlag(pinCmd, &profile)
+	return pinCmd
+}
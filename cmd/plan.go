@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jharshman/fwsync/config"
+	"github.com/jharshman/fwsync/internal/providers/generic"
+	"github.com/spf13/cobra"
+)
+
+// ExitCodeChangesPending is the exit status used by plan and --dry-run when applying the local
+// configuration would change the firewall.
+const ExitCodeChangesPending = 2
+
+// ExitError is returned by commands that need to exit with a specific status code without
+// it being treated as a failure.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// Plan displays the changes a sync would make to the firewall rule without applying them.
+// It exits with ExitCodeChangesPending when there are changes.
+func Plan() *cobra.Command {
+	var overwrite bool
+	var profile string
+
+	planCmd := &cobra.Command{
+		SilenceErrors: true, // errors are always propogated to main, no need to print again
+		Use:           "plan",
+		Short:         "Show the changes a sync would make to the firewall.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// get local configuration
+			_, cfg, err := loadProfile(profile)
+			if err != nil {
+				return err
+			}
+
+			client, err := cfg.AuthForProvider()
+			if err != nil {
+				return err
+			}
+
+			return plan(client, cfg, overwrite)
+		},
+	}
+	profileFlag(planCmd, &profile)
+	planCmd.Flags().BoolVar(&overwrite, "overwrite", false,
+		"Plan replacing all source ranges on the firewall, including ones not managed by fwsync")
+	return planCmd
+}
+
+// plan fetches the firewall rule and prints the difference between it and the local configuration.
+// It returns an *ExitError with ExitCodeChangesPending when there are changes.
+func plan(client generic.Provider, config *config.Config, overwrite bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	changes, err := pending(ctx, client, config, overwrite)
+	if err != nil {
+		return err
+	}
+	printPlan(config.Name, changes)
+
+	if changes.Pending() {
+		return &ExitError{Code: ExitCodeChangesPending}
+	}
+	return nil
+}
+
+// pending fetches the firewall rule and returns the changes a sync would make to it.
+func pending(ctx context.Context, client generic.Provider, config *config.Config, overwrite bool) (generic.Changes, error) {
+	fw, err := client.Get(ctx, config.Name)
+	if err != nil {
+		return generic.Changes{}, err
+	}
+	return generic.Diff(remoteRanges(fw), config.Desired(remoteRanges(fw), overwrite)), nil
+}
+
+func printPlan(name string, changes generic.Changes) {
+	if !changes.Pending() {
+		fmt.Printf("No changes. Firewall %s is up-to-date.\n", name)
+		return
+	}
+
+	fmt.Printf("fwsync will perform the following changes to %s:\n\n", name)
+	for _, r := range changes.Added {
+		fmt.Printf("  + %s\n", r)
+	}
+	for _, r := range changes.Removed {
+		fmt.Printf("  - %s\n", r)
+	}
+	for _, r := range changes.Unchanged {
+		fmt.Printf("    %s\n", r)
+	}
+	fmt.Printf("\nPlan: %d to add, %d to remove, %d unchanged.\n", len(changes.Added), len(changes.Removed), len(changes.Unchanged))
+}
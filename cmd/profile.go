@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/jharshman/fwsync/config"
+	"github.com/spf13/cobra"
+)
+
+// profileEnv selects the profile when --profile is not set.
+const profileEnv = "FWSYNC_PROFILE"
+
+// profileFlag registers the --profile flag on cmd.
+func profileFlag(cmd *cobra.Command, profile *string) {
+	cmd.Flags().StringVar(profile, "profile", os.Getenv(profileEnv),
+		"Configuration profile to use, defaults to $"+profileEnv+" or the file's default profile")
+}
+
+// overwriteFlag registers the --overwrite flag on cmd.
+func overwriteFlag(cmd *cobra.Command, overwrite *bool) {
+	cmd.Flags().BoolVar(overwrite, "overwrite", false,
+		"Replace all source ranges on the firewall, including ones not managed by fwsync")
+}
+
+// loadFile reads ~/.fwsync.
+func loadFile() (*config.File, error) {
+	f, err := os.Open(cfgFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return config.LoadFile(f)
+}
+
+// loadProfile reads ~/.fwsync and returns it along with the selected profile.
+// Changes to the returned profile are saved by passing the file to save.
+func loadProfile(profile string) (*config.File, *config.Config, error) {
+	file, err := loadFile()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg, err := file.Profile(profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, cfg, nil
+}
+
+// save writes the configuration file to ~/.fwsync.
+func save(file *config.File) error {
+	f, err := os.Create(cfgFilePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return file.Write(f)
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// Prune removes the expired IPs from the local configuration and then syncs the firewall rule to remove them
+// there as well. IPs expire once their expires_at passed or once max_age passed since they were last seen.
+func Prune() *cobra.Command {
+	var dryRun bool
+	var overwrite bool
+	var profile string
+
+	pruneCmd := &cobra.Command{
+		SilenceErrors: true, // errors are always propogated to main, no need to print again
+		Use:           "prune",
+		Short:         "Remove expired IPs from the firewall.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// get local configuration
+			file, cfg, err := loadProfile(profile)
+			if err != nil {
+				return err
+			}
+
+			pruned := cfg.Prune()
+			if len(pruned) == 0 {
+				fmt.Println("No expired IPs, skipping sync.")
+				return nil
+			}
+			printPruned(pruned)
+			return syncProfile(file, cfg, dryRun, overwrite)
+		},
+	}
+	profileFlag(pruneCmd, &profile)
+	pruneCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the changes without writing the configuration or syncing the firewall")
+	overwriteFlag(pruneCmd, &overwrite)
+	return pruneCmd
+}
+
+// printPruned lists the expired IPs pruned from a configuration.
+func printPruned(pruned []string) {
+	for _, ip := range pruned {
+		fmt.Printf("IP expired: %s\n", ip)
+	}
+}
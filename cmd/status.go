@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jharshman/fwsync/config"
+	"github.com/jharshman/fwsync/internal/providers/generic"
+	"github.com/spf13/cobra"
+)
+
+// Status compares the source IPs configured in ~/.fwsync with the source IPs active on the firewall.
+// Ranges not managed by fwsync that were added since the last change recorded in ~/.fwsync_history
+// are reported as drift as well. It exits with ExitCodeChangesPending when the two have drifted apart.
+func Status() *cobra.Command {
+	var quiet bool
+	var overwrite bool
+	var profile string
+
+	statusCmd := &cobra.Command{
+		SilenceErrors: true, // errors are always propogated to main, no need to print again
+		Use:           "status",
+		Short:         "Detect drift between local config and firewall.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// get local configuration
+			_, cfg, err := loadProfile(profile)
+			if err != nil {
+				return err
+			}
+
+			client, err := cfg.AuthForProvider()
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			fw, err := client.Get(ctx, cfg.Name)
+			if err != nil {
+				return err
+			}
+
+			changes := generic.Diff(remoteRanges(fw), cfg.Desired(remoteRanges(fw), overwrite))
+
+			// ranges fwsync doesn't own are kept on the firewall, but only the ones that were there when fwsync
+			// last synced it are expected. Any other was added outside of fwsync, e.g. in the cloud console.
+			var unexpected []string
+			if !overwrite {
+				history, err := loadHistory()
+				if err != nil {
+					return err
+				}
+				if last, ok := history.Last(cfg); ok {
+					unexpected = cfg.Unexpected(changes, last)
+				}
+			}
+
+			if !quiet {
+				printStatus(cfg, changes, unexpected, overwrite)
+			}
+
+			if changes.Pending() || len(unexpected) > 0 {
+				return &ExitError{Code: ExitCodeChangesPending}
+			}
+			return nil
+		},
+	}
+	profileFlag(statusCmd, &profile)
+	statusCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Print nothing, only report drift through the exit status")
+	statusCmd.Flags().BoolVar(&overwrite, "overwrite", false, "Report source ranges not managed by fwsync as drift")
+	return statusCmd
+}
+
+func printStatus(config *config.Config, changes generic.Changes, unexpected []string, overwrite bool) {
+	name := config.Name
+	added := make(map[string]bool, len(unexpected))
+	for _, r := range unexpected {
+		added[r] = true
+	}
+
+	for _, r := range changes.Unchanged {
+		if added[r] {
+			continue
+		}
+		if _, ok := config.HasIP(r); !ok {
+			// kept on the firewall, but not owned by fwsync.
+			fmt.Printf("  unmanaged    %s\n", r)
+			continue
+		}
+		fmt.Printf("  in-sync      %s\n", r)
+	}
+	for _, r := range changes.Added {
+		fmt.Printf("  local-only   %s\n", r)
+	}
+	for _, r := range changes.Removed {
+		fmt.Printf("  remote-only  %s\n", r)
+	}
+	for _, r := range unexpected {
+		fmt.Printf("  remote-only  %s\n", r)
+	}
+
+	if !changes.Pending() && len(unexpected) == 0 {
+		fmt.Printf("\nFirewall %s is in sync with local config.\n", name)
+		return
+	}
+
+	fmt.Printf("\nDrift detected on firewall %s: %d local-only, %d remote-only.\n",
+		name, len(changes.Added), len(changes.Removed)+len(unexpected))
+	if len(changes.Removed) > 0 && overwrite {
+		fmt.Println("Remote-only entries were added outside of fwsync, e.g. in the cloud console.")
+	} else if len(changes.Removed) > 0 {
+		fmt.Println("Remote-only entries are managed by fwsync but no longer in local config.")
+	}
+	if len(unexpected) > 0 {
+		fmt.Println("Remote-only entries not managed by fwsync were added outside of fwsync since the last sync, " +
+			"e.g. in the cloud console.")
+	}
+	if len(changes.Added) > 0 {
+		fmt.Println("Local-only entries are missing from the firewall, they may have been removed outside of fwsync.")
+	}
+	if overwrite {
+		fmt.Println("Run `fwsync sync --overwrite` to make the firewall match local config.")
+		return
+	}
+	if len(unexpected) > 0 {
+		fmt.Println("Run `fwsync sync` to keep the entries added outside of fwsync as unmanaged, " +
+			"or `fwsync sync --overwrite` to remove them.")
+		return
+	}
+	fmt.Println("Run `fwsync sync` to make the firewall match local config.")
+}
@@ -3,115 +3,254 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"os"
+	"slices"
 	"time"
 
 	"github.com/jharshman/fwsync/config"
+	"github.com/jharshman/fwsync/internal/providers/generic"
+	"github.com/jharshman/fwsync/internal/transaction"
 	"github.com/spf13/cobra"
 )
 
 // Update will intelligently update the firewall rule if the user's public IP has changed and doesn't exist in the
-// current rule. If the IP is to be added and the number of IPs in the rule exceeds 5, the oldest IP is dropped from the list.
+// current rule. If the IP is to be added and the number of IPs in the rule exceeds 5, the least recently seen IP
+// that is not pinned is dropped from the list.
+// Expired IPs are pruned before syncing.
+// With --all every profile in ~/.fwsync is updated concurrently.
 func Update() *cobra.Command {
 
 	// Local variable shared between the closures.
+	var file *config.File
 	var local *config.Config
+	var client generic.Provider
 	var skipSync bool
+	var dryRun bool
+	var overwrite bool
+	var profile string
+	var all bool
+	var timeout time.Duration
+	var label string
+	var note string
+	var allowUnsafe bool
 
-	return &cobra.Command{
+	updateCmd := &cobra.Command{
 		SilenceErrors: true, // errors are always propogated to main, no need to print again
 		Use:           "update",
 		Short:         "Allow a new IP on the firewall.",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if all {
+				return updateAll(timeout, dryRun, overwrite, allowUnsafe, label, note)
+			}
+
 			// get local configuration
-			f, err := os.OpenFile(cfgFilePath, os.O_RDWR, 0666)
+			var cfg *config.Config
+			var err error
+			file, cfg, err = loadProfile(profile)
 			if err != nil {
 				return err
 			}
-			defer f.Close()
 
-			cfg, err := config.LoadFromFile(f)
+			client, err = cfg.AuthForProvider()
 			if err != nil {
 				return err
 			}
 
-			FirewallClient, err = cfg.AuthForProvider()
+			// IPv4 and, on dual-stack networks, IPv6.
+			currentIPs, err := publicIPs(file, allowUnsafe)
 			if err != nil {
 				return err
 			}
 
-			currentIP, err := config.PublicIP()
+			added, pruned, err := cfg.Refresh(currentIPs, label, note)
 			if err != nil {
 				return err
 			}
-			_, ipExists := cfg.HasIP(currentIP)
-			if ipExists {
-				skipSync = true
-				return nil
-			}
-
-			// Remove oldest in list.
-			// Update appends at end so oldest will be front of list.
-			cfg.Add(currentIP)
+			printPruned(pruned)
+			skipSync = !added && len(pruned) == 0
 			local = cfg
 
-			// truncate file for writing
-			// cannot use Create or os.O_TRUNC
-			// The file must read/writable and not truncated before the read
-			f.Truncate(0)
-			f.Seek(0, 0)
+			// leave the configuration file untouched, PostRunE will print the plan.
+			if dryRun {
+				return nil
+			}
 
-			return cfg.Write(f)
+			// saved even when skipping sync, to record when the IPs were last seen.
+			return save(file)
 		},
 		PostRunE: func(cmd *cobra.Command, args []string) error {
+			if all {
+				return nil
+			}
 			if skipSync {
 				fmt.Println("IPs are up-to-date, skipping sync.")
 				return nil
 			}
+			if dryRun {
+				return plan(client, local, overwrite)
+			}
 			fmt.Println("syncing firewall rule")
-			return synchronize(local)
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			change, err := synchronize(ctx, client, local, overwrite)
+			if err != nil {
+				return err
+			}
+			if err := save(file); err != nil {
+				return err
+			}
+			return record(change)
 		},
 	}
+	profileFlag(updateCmd, &profile)
+	updateCmd.Flags().BoolVar(&dryRun, "dry-run", false,
+		"Show the changes without writing the configuration or syncing the firewall")
+	overwriteFlag(updateCmd, &overwrite)
+	updateCmd.Flags().BoolVar(&all, "all", false, "Update the firewalls of every profile concurrently")
+	updateCmd.Flags().DurationVar(&timeout, "timeout", syncTimeout, "Time allowed to sync each firewall")
+	updateCmd.Flags().StringVar(&label, "label", "", "Label your current IPs, e.g. home or office")
+	updateCmd.Flags().StringVar(&note, "note", "", "Attach a note to your current IPs")
+	allowUnsafeFlag(updateCmd, &allowUnsafe)
+	updateCmd.MarkFlagsMutuallyExclusive("all", "profile")
+	return updateCmd
 }
 
 // Sync initiates a manual synchronization of the local configuration stored in ~/.fwsync to the desired GCP Firewall.
+// With --all the firewalls of every profile are synced as a single transaction.
 func Sync() *cobra.Command {
-	return &cobra.Command{
+	var dryRun bool
+	var overwrite bool
+	var profile string
+	var all bool
+
+	syncCmd := &cobra.Command{
 		SilenceErrors: true, // errors are always propogated to main, no need to print again
 		Use:           "sync",
 		Short:         "Synchronize local config with firewall",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if all {
+				return syncAll(dryRun, overwrite)
+			}
+
 			// get local configuration
-			f, err := os.OpenFile(cfgFilePath, os.O_RDWR, 0666)
+			file, cfg, err := loadProfile(profile)
 			if err != nil {
 				return err
 			}
-			defer f.Close()
 
-			cfg, err := config.LoadFromFile(f)
+			client, err := cfg.AuthForProvider()
 			if err != nil {
 				return err
 			}
 
-			FirewallClient, err = cfg.AuthForProvider()
+			if dryRun {
+				return plan(client, cfg, overwrite)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+			defer cancel()
+			change, err := synchronize(ctx, client, cfg, overwrite)
 			if err != nil {
 				return err
 			}
-
-			return synchronize(cfg)
+			if err := save(file); err != nil {
+				return err
+			}
+			return record(change)
 		},
 	}
+	profileFlag(syncCmd, &profile)
+	syncCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the changes without syncing the firewall")
+	overwriteFlag(syncCmd, &overwrite)
+	syncCmd.Flags().BoolVar(&all, "all", false, "Sync the firewalls of every profile, rolling all of them back if one fails")
+	syncCmd.MarkFlagsMutuallyExclusive("all", "profile")
+	return syncCmd
 }
 
-// synchronize will use the local configuration update the desired firewall rule.
-func synchronize(config *config.Config) error {
-	// CIDR notation required by GoogleAPIs.
-	for idx := range config.SourceIPs {
-		config.SourceIPs[idx] = config.SourceIPs[idx] + "/32"
+const (
+	// syncAttempts is the number of times a sync is attempted when the firewall is modified concurrently.
+	syncAttempts = 3
+	// syncTimeout bounds a whole sync of one firewall, including waiting for the provider to apply the change.
+	syncTimeout = time.Minute
+)
+
+// syncProfile syncs the firewall of a profile after its IPs were changed locally. The configuration file
+// is saved before syncing so the change is kept if the sync fails, and again afterwards to record the
+// managed ranges. With dryRun nothing is written and the plan is printed instead.
+func syncProfile(file *config.File, cfg *config.Config, dryRun, overwrite bool) error {
+	client, err := cfg.AuthForProvider()
+	if err != nil {
+		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	if dryRun {
+		return plan(client, cfg, overwrite)
+	}
+	if err := save(file); err != nil {
+		return err
+	}
+	fmt.Println("syncing firewall rule")
+
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
 	defer cancel()
+	change, err := synchronize(ctx, client, cfg, overwrite)
+	if err != nil {
+		return err
+	}
+	if err := save(file); err != nil {
+		return err
+	}
+	return record(change)
+}
+
+// synchronize will use the local configuration update the desired firewall rule.
+// Unless overwrite is set, ranges on the firewall that fwsync does not own are preserved. If the firewall
+// is modified while syncing, it is read again and the merge is retried.
+// Source IPs are converted to the provider's address format on the way out. On success the
+// source IPs are recorded as managed and the applied change is returned, it is up to the caller
+// to save the configuration and record the change.
+func synchronize(ctx context.Context, client generic.Provider, cfg *config.Config, overwrite bool) (config.Change, error) {
+	applied, err := transaction.Sync(ctx, syncTarget(cfg, client, overwrite), syncAttempts, func() {
+		fmt.Println("firewall was modified while syncing, retrying")
+	})
+	if err != nil {
+		return config.Change{}, err
+	}
+
+	change := appliedChange(cfg, applied)
+	cfg.Managed = cfg.IPs()
+	return change, nil
+}
+
+// syncTarget returns the profile's firewall as a transaction target, updated with the source IPs while keeping
+// ranges fwsync does not own unless overwrite is set.
+func syncTarget(cfg *config.Config, client generic.Provider, overwrite bool) transaction.Target {
+	return transaction.Target{
+		Name:     cfg.Profile,
+		Provider: client,
+		Firewall: cfg.Name,
+		Ranges: func(snapshot *generic.Firewall) []string {
+			return cfg.Desired(remoteRanges(snapshot), overwrite)
+		},
+	}
+}
+
+// appliedChange describes a change applied to the profile's firewall for the history. It must be called before
+// the ranges now managed are recorded in the profile.
+func appliedChange(cfg *config.Config, applied transaction.Applied) config.Change {
+	return config.Change{
+		Time:            time.Now().UTC(),
+		Profile:         cfg.Profile,
+		Provider:        cfg.Provider,
+		Firewall:        cfg.Name,
+		Previous:        generic.FromWire(applied.Previous),
+		Current:         applied.Current,
+		PreviousManaged: slices.Clone(cfg.Owned()),
+	}
+}
 
-	return FirewallClient.Update(ctx, config.Name, config.SourceIPs)
+func remoteRanges(fw *generic.Firewall) []string {
+	ranges := make([]string, 0, len(fw.AllowedIPv4Addresses)+len(fw.AllowedIPv6Addresses))
+	ranges = append(ranges, fw.AllowedIPv4Addresses...)
+	return append(ranges, fw.AllowedIPv6Addresses...)
 }
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// maxResponseExcerpt bounds how much of an unexpected response body is included in an error.
+const maxResponseExcerpt = 64
+
+// InvalidAddressError is returned when a value is not a valid IP address or CIDR range.
+type InvalidAddressError struct {
+	Value string
+	Err   error
+}
+
+func (e *InvalidAddressError) Error() string {
+	return fmt.Sprintf("invalid IP address or CIDR range %q: %v", e.Value, e.Err)
+}
+
+func (e *InvalidAddressError) Unwrap() error {
+	return e.Err
+}
+
+// UnexpectedResponseError is returned when a public IP endpoint responds with something
+// other than a single IP address of the requested family, such as a captive portal page.
+type UnexpectedResponseError struct {
+	URL  string
+	Body string
+}
+
+func (e *UnexpectedResponseError) Error() string {
+	body := e.Body
+	if len(body) > maxResponseExcerpt {
+		body = body[:maxResponseExcerpt] + "..."
+	}
+	return fmt.Sprintf("unexpected response from %s: %q", e.URL, body)
+}
+
+// Normalize parses an IP address or CIDR range and returns its canonical CIDR form. IPv4 addresses
+// are allowed as a single host. IPv6 addresses are widened to IPv6Prefix since hosts commonly rotate
+// through temporary addresses within their prefix. CIDR ranges have their host bits cleared.
+func (c *Config) Normalize(value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	var prefix netip.Prefix
+	if strings.Contains(value, "/") {
+		p, err := netip.ParsePrefix(value)
+		if err != nil {
+			return "", &InvalidAddressError{Value: value, Err: err}
+		}
+		prefix = p
+	} else {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return "", &InvalidAddressError{Value: value, Err: err}
+		}
+		if addr.Zone() != "" {
+			return "", &InvalidAddressError{Value: value, Err: fmt.Errorf("zoned addresses are not allowed")}
+		}
+		addr = addr.Unmap()
+
+		bits := addr.BitLen()
+		if addr.Is6() {
+			bits = c.IPv6Prefix
+			if bits == 0 {
+				bits = defaultIPv6Prefix
+			}
+		}
+
+		p, err := addr.Prefix(bits)
+		if err != nil {
+			return "", &InvalidAddressError{Value: value, Err: err}
+		}
+		return p.String(), nil
+	}
+
+	if prefix.Addr().Is4In6() {
+		bits := prefix.Bits() - 96
+		if bits < 0 {
+			return "", &InvalidAddressError{Value: value, Err: fmt.Errorf("IPv4-mapped prefix shorter than /96")}
+		}
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), bits)
+	}
+
+	return prefix.Masked().String(), nil
+}
+
+// parseIP validates that body holds a single IP address of the requested family and returns it
+// in its canonical form.
+func parseIP(url, body string, ipv6 bool) (string, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(body))
+	if err != nil || addr.Zone() != "" {
+		return "", &UnexpectedResponseError{URL: url, Body: body}
+	}
+
+	addr = addr.Unmap()
+	if addr.Is6() != ipv6 {
+		return "", &UnexpectedResponseError{URL: url, Body: body}
+	}
+
+	return addr.String(), nil
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"net/http"
-	"strings"
+	"net/netip"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/jharshman/fwsync/internal/providers/aws"
+	"github.com/jharshman/fwsync/internal/providers/azure"
+	"github.com/jharshman/fwsync/internal/providers/digitalocean"
 	"github.com/jharshman/fwsync/internal/providers/gcp"
 	"github.com/jharshman/fwsync/internal/providers/generic"
 	"github.com/jharshman/fwsync/internal/providers/linode"
@@ -15,53 +19,115 @@ import (
 )
 
 const (
-	defaultIPLimit = 5
-	ipURL          = "https://ipv4.icanhazip.com"
+	defaultIPLimit    = 5
+	defaultIPv6Prefix = 128
+	// resolveTimeout bounds detecting the public IPv4 and IPv6 addresses.
+	resolveTimeout = 5 * time.Second
 )
 
 var (
 	// providers
-	ProviderGoogle = "google"
-	ProviderLinode = "linode"
-
-	// todo: implement the following providers
-	//providerAWS          = "amazon"
-	//providerAzure        = "azure"
-	//providerDigitalOcean = "digitalocean"
+	ProviderGoogle       = "google"
+	ProviderLinode       = "linode"
+	ProviderAWS          = "amazon"
+	ProviderAzure        = "azure"
+	ProviderDigitalOcean = "digitalocean"
 )
 
 // Config describes the fwsync configuration. It is used to hold basic information about the
 // firewall and the desired IPs that are to be allowed.
 type Config struct {
-	Provider  string   `yaml:"provider"`
-	Project   string   `yaml:"project,omitempty"`
-	IPLimit   int      `yaml:"ip_limit,omitempty"`
-	Name      string   `yaml:"name"`
-	SourceIPs []string `yaml:"ips"`
+	Provider      string  `yaml:"provider"`
+	Project       string  `yaml:"project,omitempty"`
+	Region        string  `yaml:"region,omitempty"`
+	Subscription  string  `yaml:"subscription,omitempty"`
+	ResourceGroup string  `yaml:"resource_group,omitempty"`
+	IPLimit       int     `yaml:"ip_limit,omitempty"`
+	IPv6Prefix    int     `yaml:"ipv6_prefix,omitempty"`
+	Name          string  `yaml:"name"`
+	Rule          string  `yaml:"rule,omitempty"`
+	SourceIPs     []Entry `yaml:"ips"`
+	// MaxAge is how long an IP stays allowed after it was last seen. IPs never expire with age if zero.
+	MaxAge time.Duration `yaml:"max_age,omitempty"`
+	// Managed holds the source IPs fwsync applied to the firewall on the last sync.
+	// Ranges on the firewall that are not in this list are left alone unless syncing with --overwrite.
+	Managed []string `yaml:"managed,omitempty"`
+	// Profile is the name of the profile in the configuration file holding this Config.
+	Profile string `yaml:"-"`
 }
 
 // New creates a new Config and returns a pointer to it.
-func New(opts ...configOpts) *Config {
+func New(opts ...configOpts) (*Config, error) {
 	cfg := &Config{}
 	cfg.IPLimit = defaultIPLimit // always set the IPLimit equal to the defaultIPLimit.
 
 	for _, opt := range opts {
-		opt(cfg)
+		if err := opt(cfg); err != nil {
+			return nil, err
+		}
 	}
 
-	return cfg
+	return cfg, nil
 }
 
-// LoadFromFile creates a new Config from the .fwsync configuration file.
+// LoadFromFile creates a new Config from a single profile .fwsync configuration file.
+// Use LoadFile to read a configuration file holding several profiles.
+// Every source IP is validated and converted to its canonical CIDR form.
 func LoadFromFile(r io.Reader) (*Config, error) {
 	config := &Config{}
 	err := yaml.NewDecoder(r).Decode(config)
 	if err != nil {
 		return nil, err
 	}
+
+	if err := config.normalize(); err != nil {
+		return nil, err
+	}
 	return config, nil
 }
 
+// normalize converts the source IPs and managed IPs to their canonical CIDR form and validates the ip limit.
+// An ip limit left out of the file is 0 and replaced with the default when an IP is added.
+func (c *Config) normalize() error {
+	if c.IPLimit < 0 {
+		return fmt.Errorf("invalid ip_limit: %d, must be at least 1", c.IPLimit)
+	}
+
+	var err error
+	for idx, entry := range c.SourceIPs {
+		c.SourceIPs[idx].IP, err = c.Normalize(entry.IP)
+		if err != nil {
+			return err
+		}
+	}
+	for idx, ip := range c.Managed {
+		c.Managed[idx], err = c.Normalize(ip)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Owned returns the source IPs fwsync is allowed to remove from the firewall.
+// Configurations written before fwsync tracked ownership own exactly their source IPs,
+// since fwsync used to overwrite the firewall with them.
+func (c *Config) Owned() []string {
+	if c.Managed == nil {
+		return c.IPs()
+	}
+	return c.Managed
+}
+
+// IPs returns the source IPs without their metadata.
+func (c *Config) IPs() []string {
+	ips := make([]string, 0, len(c.SourceIPs))
+	for _, entry := range c.SourceIPs {
+		ips = append(ips, entry.IP)
+	}
+	return ips
+}
+
 // AuthForProvider authenticates for a given supported Cloud Provider and returns the
 // provider's implementation of generic.Provider.
 func (c *Config) AuthForProvider() (generic.Provider, error) {
@@ -71,7 +137,13 @@ func (c *Config) AuthForProvider() (generic.Provider, error) {
 	case ProviderGoogle:
 		client, err = gcp.New(c.Project)
 	case ProviderLinode:
-		client, err = linode.New()
+		client, err = linode.New(c.Rule)
+	case ProviderAWS:
+		client, err = aws.New(c.Region, c.Rule)
+	case ProviderAzure:
+		client, err = azure.New(c.Subscription, c.ResourceGroup, c.Rule)
+	case ProviderDigitalOcean:
+		client, err = digitalocean.New(c.Rule)
 	default:
 		err = fmt.Errorf("invalid provider: %s", c.Provider)
 	}
@@ -87,31 +159,140 @@ func (c *Config) Write(w io.Writer) error {
 }
 
 // HasIP checks if the current configuration has a given IP. Returns the index of the IP and true if found.
-// Returns -1 and false if not found.
+// Returns -1 and false if not found. IPs are compared by their canonical CIDR form.
 func (c *Config) HasIP(ip string) (int, bool) {
-	for idx, sip := range c.SourceIPs {
-		if sip == ip {
+	want, err := c.Normalize(ip)
+	if err != nil {
+		return -1, false
+	}
+	for idx, entry := range c.SourceIPs {
+		if have, err := c.Normalize(entry.IP); err == nil && have == want {
 			return idx, true
 		}
 	}
 	return -1, false
 }
 
-// Add will add the given IP to the configuration file.
+// Add will add the given IP to the configuration file in its canonical CIDR form, recording it as added and seen now.
 // If the new IP puts the number of IPs held in the configuration file
-// over the limit defined by ipLimit then the oldest IP is removed.
-func (c *Config) Add(ip string) {
+// over the limit defined by ipLimit then the least recently seen IP that is not pinned is removed.
+// An *InvalidAddressError is returned if ip is not a valid IP address or CIDR range.
+// An error is returned if the limit is reached and every IP is pinned.
+func (c *Config) Add(ip string) error {
+	return c.add(ip, nil)
+}
+
+// AddCurrent adds the IPs currently detected for this host like Add, e.g. its public IPv4 and IPv6 addresses.
+// None of them is evicted to make room for another. It reports whether any IP was added.
+func (c *Config) AddCurrent(ips []string) (bool, error) {
+	keep := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		cidr, err := c.Normalize(ip)
+		if err != nil {
+			return false, err
+		}
+		keep = append(keep, cidr)
+	}
+
+	added := false
+	for _, ip := range keep {
+		if _, ok := c.HasIP(ip); ok {
+			continue
+		}
+		if err := c.add(ip, keep); err != nil {
+			return false, err
+		}
+		added = true
+	}
+	return added, nil
+}
+
+// add is Add, never evicting the IPs in keep.
+func (c *Config) add(ip string, keep []string) error {
 	if ip == "" {
-		return
+		return nil
+	}
+	cidr, err := c.Normalize(ip)
+	if err != nil {
+		return err
 	}
 	if c.IPLimit == 0 {
 		// ip limit cannot be 0
 		c.IPLimit = defaultIPLimit
 	}
-	if len(c.SourceIPs) >= c.IPLimit {
-		c.SourceIPs = c.SourceIPs[1:]
+	for len(c.SourceIPs) >= c.IPLimit {
+		idx := c.evictable(keep)
+		if idx < 0 && len(keep) > 0 {
+			return fmt.Errorf("ip limit: %d reached by pinned IPs and the IPs detected now, raise ip_limit to add: %s", c.IPLimit, cidr)
+		}
+		if idx < 0 {
+			return fmt.Errorf("ip limit: %d reached and every IP is pinned, unpin an IP to add: %s", c.IPLimit, cidr)
+		}
+		c.Remove(c.SourceIPs[idx].IP)
+	}
+	at := now()
+	c.SourceIPs = append(c.SourceIPs, Entry{IP: cidr, AddedAt: at, LastSeenAt: at})
+	return nil
+}
+
+// evictable returns the index of the least recently seen IP that is neither pinned nor in keep, or -1 if there
+// is none. IPs never seen count as seen when added, IPs without either are evicted first. Ties go to the first IP.
+func (c *Config) evictable(keep []string) int {
+	idx := -1
+	var oldest time.Time
+	for i, entry := range c.SourceIPs {
+		if entry.Pinned || slices.Contains(keep, entry.IP) {
+			continue
+		}
+		if seen := entry.seen(); idx < 0 || seen.Before(oldest) {
+			idx, oldest = i, seen
+		}
+	}
+	return idx
+}
+
+// Allow adds the given IP like Add and sets it to expire once d has passed. The IP does not expire at a fixed
+// time if d is zero. An IP already held by the configuration keeps its metadata and is given the new expiry.
+// Unlike Add, an empty ip is an *InvalidAddressError.
+func (c *Config) Allow(ip string, d time.Duration) error {
+	cidr, err := c.Normalize(ip)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.HasIP(cidr); !ok {
+		if err := c.Add(cidr); err != nil {
+			return err
+		}
 	}
-	c.SourceIPs = append(c.SourceIPs, ip)
+
+	entry := c.Entry(cidr)
+	if entry == nil {
+		return fmt.Errorf("IP: %s not found after adding it", cidr)
+	}
+	entry.ExpiresAt = time.Time{}
+	if d > 0 {
+		entry.ExpiresAt = now().Add(d)
+	}
+	return nil
+}
+
+// Entry returns the entry holding the given IP, which can be modified in place. Returns nil if not found.
+func (c *Config) Entry(ip string) *Entry {
+	idx, ok := c.HasIP(ip)
+	if !ok {
+		return nil
+	}
+	return &c.SourceIPs[idx]
+}
+
+// Seen records that the given IP was seen now. It reports whether the configuration holds the IP.
+func (c *Config) Seen(ip string) bool {
+	entry := c.Entry(ip)
+	if entry == nil {
+		return false
+	}
+	entry.LastSeenAt = now()
+	return true
 }
 
 // Remove will remove an IP from the configuration.
@@ -126,33 +307,106 @@ func (c *Config) Remove(ip string) {
 
 	chunkOne := c.SourceIPs[:idx]
 	chunkTwo := c.SourceIPs[idx+1:]
-	var newIPs []string
+	var newIPs []Entry
 	newIPs = append(newIPs, chunkOne...)
 	newIPs = append(newIPs, chunkTwo...)
 
 	c.SourceIPs = newIPs
 }
 
-// PublicIP fetches the current public IP from the URL defined by ipURL.
+// Prune removes the expired IPs from the configuration and returns them.
+// See Entry.Expired for when an IP expires.
+func (c *Config) Prune() []string {
+	at := now()
+	var pruned []string
+	for _, entry := range c.SourceIPs {
+		if entry.Expired(at, c.MaxAge) {
+			pruned = append(pruned, entry.IP)
+		}
+	}
+	for _, ip := range pruned {
+		c.Remove(ip)
+	}
+	return pruned
+}
+
+// PublicIP detects the current public IPv4 address with the DefaultResolvers, see DetectPublicIPs.
 // On error, it will return an empty string and error.
 func PublicIP() (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	req, err := http.NewRequestWithContext(ctx, "GET", ipURL, nil)
+	return publicIP(false)
+}
+
+// PublicIPv6 detects the current public IPv6 address with the DefaultResolvers, see DetectPublicIPs.
+// On error, it will return an empty string and error. An error is expected on networks without IPv6.
+func PublicIPv6() (string, error) {
+	return publicIP(true)
+}
+
+func publicIP(ipv6 bool) (string, error) {
+	detections, err := DetectPublicIPs()
 	if err != nil {
 		return "", err
 	}
+	for _, d := range detections {
+		if addr, err := netip.ParseAddr(d.IP); err == nil && addr.Is6() == ipv6 {
+			return d.IP, nil
+		}
+	}
+	if ipv6 {
+		return "", fmt.Errorf("unable to determine public IPv6 address")
+	}
+	return "", fmt.Errorf("unable to determine public IPv4 address")
+}
 
-	res, err := http.DefaultClient.Do(req)
+// PublicIPs detects the current public IPv4 and IPv6 addresses with the given resolvers, or the DefaultResolvers
+// if none are given. Only the address families that could be detected are returned. An error is returned when
+// neither could be detected. Use DetectPublicIPs to learn whether the addresses are safe to allow on a firewall.
+func PublicIPs(resolvers ...Resolver) ([]string, error) {
+	detections, err := DetectPublicIPs(resolvers...)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	ips := make([]string, 0, len(detections))
+	for _, d := range detections {
+		ips = append(ips, d.IP)
 	}
-	defer res.Body.Close()
+	return ips, nil
+}
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return "", err
+// DetectPublicIPs is like PublicIPs, but returns warnings about allowing the addresses on a firewall, see Detect.
+func DetectPublicIPs(resolvers ...Resolver) ([]Detection, error) {
+	if len(resolvers) == 0 {
+		resolvers = DefaultResolvers
+	}
+
+	// both families are detected under one deadline, IPv6 is often blackholed rather than missing.
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+
+	var ipv4, ipv6 Detection
+	var err4, err6 error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		ipv4, err4 = Detect(ctx, resolvers, false)
+	}()
+	go func() {
+		defer wg.Done()
+		ipv6, err6 = Detect(ctx, resolvers, true)
+	}()
+	wg.Wait()
+
+	var detections []Detection
+	if err4 == nil && ipv4.IP != "" {
+		detections = append(detections, ipv4)
+	}
+	if err6 == nil && ipv6.IP != "" {
+		detections = append(detections, ipv6)
 	}
 
-	return strings.TrimSpace(string(body)), nil
+	if len(detections) == 0 {
+		return nil, fmt.Errorf("unable to determine public IP: ipv4: %v, ipv6: %v", err4, err6)
+	}
+	return detections, nil
 }
@@ -2,11 +2,41 @@ package config
 
 import (
 	"bytes"
+	"errors"
+	"net/netip"
 	"testing"
+	"time"
 
 	"github.com/matryer/is"
 )
 
+// testTime is returned by now in tests.
+var testTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func init() {
+	now = func() time.Time { return testTime }
+	// keep the host's interfaces out of carrier-grade NAT detection.
+	localAddrs = func() (map[string][]netip.Addr, error) { return nil, nil }
+}
+
+// entries returns entries without metadata for the given IPs, as read from a file of plain IPs.
+func entries(ips ...string) []Entry {
+	out := make([]Entry, 0, len(ips))
+	for _, ip := range ips {
+		out = append(out, Entry{IP: ip})
+	}
+	return out
+}
+
+// added returns entries for the given IPs, added and last seen at testTime.
+func added(ips ...string) []Entry {
+	out := entries(ips...)
+	for i := range out {
+		out[i].AddedAt, out[i].LastSeenAt = testTime, testTime
+	}
+	return out
+}
+
 func TestNewConfig(t *testing.T) {
 
 	tests := []struct {
@@ -29,13 +59,13 @@ func TestNewConfig(t *testing.T) {
 			expected: &Config{
 				Name:    "firstname-lastname-firewall-rule",
 				IPLimit: defaultIPLimit,
-				SourceIPs: []string{
-					"1.1.1.1",
-					"2.2.2.2",
-					"3.3.3.3",
-					"4.4.4.4",
-					"5.5.5.5",
-				},
+				SourceIPs: added(
+					"1.1.1.1/32",
+					"2.2.2.2/32",
+					"3.3.3.3/32",
+					"4.4.4.4/32",
+					"5.5.5.5/32",
+				),
 			},
 		},
 		{
@@ -47,9 +77,9 @@ func TestNewConfig(t *testing.T) {
 			expected: &Config{
 				Name:    "firstname-lastname-firewall-rule",
 				IPLimit: defaultIPLimit,
-				SourceIPs: []string{
-					"1.1.1.1",
-				},
+				SourceIPs: added(
+					"1.1.1.1/32",
+				),
 			},
 		},
 		{
@@ -75,13 +105,13 @@ func TestNewConfig(t *testing.T) {
 			expected: &Config{
 				Name:    "firstname-lastname-firewall-rule",
 				IPLimit: defaultIPLimit,
-				SourceIPs: []string{
-					"1.1.1.1",
-					"2.2.2.2",
-					"3.3.3.3",
-					"4.4.4.4",
-					"5.5.5.5",
-				},
+				SourceIPs: added(
+					"1.1.1.1/32",
+					"2.2.2.2/32",
+					"3.3.3.3/32",
+					"4.4.4.4/32",
+					"5.5.5.5/32",
+				),
 			},
 		},
 	}
@@ -90,10 +120,11 @@ func TestNewConfig(t *testing.T) {
 		tc := tc
 		t.Run(tc.description, func(t *testing.T) {
 			is := is.New(t)
-			got := New(
+			got, err := New(
 				WithFirewall(tc.argFwID),
 				WithSourceIPs(tc.argIPs...))
 
+			is.NoErr(err)
 			is.Equal(got, tc.expected)
 		})
 	}
@@ -113,11 +144,11 @@ ips:
 	is.NoErr(err)
 	is.Equal(got, &Config{
 		Name: "firstname-lastname-firewall-rule",
-		SourceIPs: []string{
-			"1.1.1.1",
-			"2.2.2.2",
-			"3.3.3.3",
-		},
+		SourceIPs: entries(
+			"1.1.1.1/32",
+			"2.2.2.2/32",
+			"3.3.3.3/32",
+		),
 	})
 }
 
@@ -127,11 +158,17 @@ project: myproject
 ip_limit: 5
 name: firstname-lastname-firewall-rule
 ips:
-- 1.1.1.1
-- 2.2.2.2
-- 3.3.3.3
+- ip: 1.1.1.1/32
+  added_at: 2024-05-01T12:00:00Z
+  last_seen_at: 2024-05-01T12:00:00Z
+- ip: 2.2.2.2/32
+  added_at: 2024-05-01T12:00:00Z
+  last_seen_at: 2024-05-01T12:00:00Z
+- ip: 3.3.3.3/32
+  added_at: 2024-05-01T12:00:00Z
+  last_seen_at: 2024-05-01T12:00:00Z
 `)
-	cfg := New(
+	cfg, err := New(
 		WithProvider("google"),
 		WithProject("myproject"),
 		WithFirewall("firstname-lastname-firewall-rule"),
@@ -141,6 +178,7 @@ ips:
 	cfg.Write(got)
 
 	is := is.New(t)
+	is.NoErr(err)
 	is.Equal(string(expected), got.String())
 }
 
@@ -157,7 +195,7 @@ func TestConfig_HasIP(t *testing.T) {
 			ip:          "1.1.1.1",
 			cfg: &Config{
 				Name:      "firstname-lastname-firewall-rule",
-				SourceIPs: []string{"2.2.2.2", "3.3.3.3"},
+				SourceIPs: entries("2.2.2.2", "3.3.3.3"),
 			},
 			expect: false,
 		},
@@ -166,7 +204,7 @@ func TestConfig_HasIP(t *testing.T) {
 			ip:          "1.1.1.1",
 			cfg: &Config{
 				Name:      "firstname-lastname-firewall-rule",
-				SourceIPs: []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"},
+				SourceIPs: entries("1.1.1.1", "2.2.2.2", "3.3.3.3"),
 			},
 			expect: true,
 		},
@@ -196,7 +234,7 @@ func TestConfig_Add(t *testing.T) {
 			ip:          "",
 			cfg: &Config{
 				Name:      "firstname-lastname-firewall-rule",
-				SourceIPs: []string{"1.1.1.1"},
+				SourceIPs: entries("1.1.1.1"),
 			},
 			expectedIPs: []string{"1.1.1.1"},
 		},
@@ -205,18 +243,18 @@ func TestConfig_Add(t *testing.T) {
 			ip:          "2.2.2.2",
 			cfg: &Config{
 				Name:      "firstname-lastname-firewall-rule",
-				SourceIPs: []string{"1.1.1.1"},
+				SourceIPs: entries("1.1.1.1"),
 			},
-			expectedIPs: []string{"1.1.1.1", "2.2.2.2"},
+			expectedIPs: []string{"1.1.1.1", "2.2.2.2/32"},
 		},
 		{
 			description: "Add IP on full list",
 			ip:          "6.6.6.6",
 			cfg: &Config{
 				Name:      "firstname-lastname-firewall-rule",
-				SourceIPs: []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4", "5.5.5.5"},
+				SourceIPs: entries("1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4", "5.5.5.5"),
 			},
-			expectedIPs: []string{"2.2.2.2", "3.3.3.3", "4.4.4.4", "5.5.5.5", "6.6.6.6"},
+			expectedIPs: []string{"2.2.2.2", "3.3.3.3", "4.4.4.4", "5.5.5.5", "6.6.6.6/32"},
 		},
 	}
 
@@ -224,8 +262,8 @@ func TestConfig_Add(t *testing.T) {
 		tc := tc
 		t.Run(tc.description, func(t *testing.T) {
 			is := is.New(t)
-			tc.cfg.Add(tc.ip)
-			is.Equal(tc.cfg.SourceIPs, tc.expectedIPs)
+			is.NoErr(tc.cfg.Add(tc.ip))
+			is.Equal(tc.cfg.IPs(), tc.expectedIPs)
 		})
 	}
 
@@ -243,11 +281,11 @@ func TestConfig_Remove(t *testing.T) {
 			ip:          "",
 			cfg: &Config{
 				Name:      "firstname-lastname-firewall-rule",
-				SourceIPs: []string{"1.1.1.1", "2.2.2.2"},
+				SourceIPs: entries("1.1.1.1", "2.2.2.2"),
 			},
 			expect: &Config{
 				Name:      "firstname-lastname-firewall-rule",
-				SourceIPs: []string{"1.1.1.1", "2.2.2.2"},
+				SourceIPs: entries("1.1.1.1", "2.2.2.2"),
 			},
 		},
 		{
@@ -255,11 +293,11 @@ func TestConfig_Remove(t *testing.T) {
 			ip:          "3.3.3.3",
 			cfg: &Config{
 				Name:      "firstname-lastname-firewall-rule",
-				SourceIPs: []string{"1.1.1.1", "2.2.2.2"},
+				SourceIPs: entries("1.1.1.1", "2.2.2.2"),
 			},
 			expect: &Config{
 				Name:      "firstname-lastname-firewall-rule",
-				SourceIPs: []string{"1.1.1.1", "2.2.2.2"},
+				SourceIPs: entries("1.1.1.1", "2.2.2.2"),
 			},
 		},
 		{
@@ -267,11 +305,11 @@ func TestConfig_Remove(t *testing.T) {
 			ip:          "3.3.3.3",
 			cfg: &Config{
 				Name:      "firstname-lastname-firewall-rule",
-				SourceIPs: []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"},
+				SourceIPs: entries("1.1.1.1", "2.2.2.2", "3.3.3.3"),
 			},
 			expect: &Config{
 				Name:      "firstname-lastname-firewall-rule",
-				SourceIPs: []string{"1.1.1.1", "2.2.2.2"},
+				SourceIPs: entries("1.1.1.1", "2.2.2.2"),
 			},
 		},
 		{
@@ -279,11 +317,11 @@ func TestConfig_Remove(t *testing.T) {
 			ip:          "3.3.3.3",
 			cfg: &Config{
 				Name:      "firstname-lastname-firewall-rule",
-				SourceIPs: []string{"1.1.1.1", "3.3.3.3", "2.2.2.2"},
+				SourceIPs: entries("1.1.1.1", "3.3.3.3", "2.2.2.2"),
 			},
 			expect: &Config{
 				Name:      "firstname-lastname-firewall-rule",
-				SourceIPs: []string{"1.1.1.1", "2.2.2.2"},
+				SourceIPs: entries("1.1.1.1", "2.2.2.2"),
 			},
 		},
 		{
@@ -291,11 +329,11 @@ func TestConfig_Remove(t *testing.T) {
 			ip:          "3.3.3.3",
 			cfg: &Config{
 				Name:      "firstname-lastname-firewall-rule",
-				SourceIPs: []string{"3.3.3.3", "1.1.1.1", "2.2.2.2"},
+				SourceIPs: entries("3.3.3.3", "1.1.1.1", "2.2.2.2"),
 			},
 			expect: &Config{
 				Name:      "firstname-lastname-firewall-rule",
-				SourceIPs: []string{"1.1.1.1", "2.2.2.2"},
+				SourceIPs: entries("1.1.1.1", "2.2.2.2"),
 			},
 		},
 	}
@@ -309,3 +347,356 @@ func TestConfig_Remove(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_Normalize(t *testing.T) {
+	tests := []struct {
+		description string
+		value       string
+		ipv6Prefix  int
+		expect      string
+		expectErr   bool
+	}{
+		{
+			description: "IPv4 address",
+			value:       "1.1.1.1",
+			expect:      "1.1.1.1/32",
+		},
+		{
+			description: "IPv4 CIDR",
+			value:       "10.1.2.3/8",
+			expect:      "10.0.0.0/8",
+		},
+		{
+			description: "IPv6 address default prefix",
+			value:       "2001:DB8::1",
+			expect:      "2001:db8::1/128",
+		},
+		{
+			description: "IPv6 address configured prefix",
+			value:       "2001:db8:0:1:aaaa::1",
+			ipv6Prefix:  64,
+			expect:      "2001:db8:0:1::/64",
+		},
+		{
+			description: "IPv6 CIDR keeps its own prefix",
+			value:       "2001:db8::/48",
+			ipv6Prefix:  64,
+			expect:      "2001:db8::/48",
+		},
+		{
+			description: "IPv4-mapped IPv6 address",
+			value:       "::ffff:1.1.1.1",
+			ipv6Prefix:  64,
+			expect:      "1.1.1.1/32",
+		},
+		{
+			description: "surrounding whitespace",
+			value:       " 1.1.1.1\n",
+			expect:      "1.1.1.1/32",
+		},
+		{
+			description: "trailing dot",
+			value:       "6.6.6.6.",
+			expectErr:   true,
+		},
+		{
+			description: "double suffix",
+			value:       "1.1.1.1/32/32",
+			expectErr:   true,
+		},
+		{
+			description: "html",
+			value:       "<html><body>Sign in to the network</body></html>",
+			expectErr:   true,
+		},
+		{
+			description: "zoned address",
+			value:       "fe80::1%eth0",
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			cfg := &Config{IPv6Prefix: tc.ipv6Prefix}
+			got, err := cfg.Normalize(tc.value)
+			if tc.expectErr {
+				var addrErr *InvalidAddressError
+				is.True(errors.As(err, &addrErr))
+				return
+			}
+			is.NoErr(err)
+			is.Equal(got, tc.expect)
+		})
+	}
+}
+
+func TestConfig_HasIP_IPv6Prefix(t *testing.T) {
+	is := is.New(t)
+	cfg := &Config{
+		IPv6Prefix: 64,
+		SourceIPs:  entries("1.1.1.1", "2001:db8:0:1::1"),
+	}
+
+	idx, ok := cfg.HasIP("2001:db8:0:1::2") // same /64
+	is.True(ok)
+	is.Equal(idx, 1)
+
+	_, ok = cfg.HasIP("2001:db8:0:2::1") // different /64
+	is.True(!ok)
+}
+
+func TestConfig_Add_Invalid(t *testing.T) {
+	is := is.New(t)
+	cfg := &Config{SourceIPs: entries("1.1.1.1/32")}
+
+	err := cfg.Add("<html>captive portal</html>")
+	var addrErr *InvalidAddressError
+	is.True(errors.As(err, &addrErr))
+	is.Equal(cfg.IPs(), []string{"1.1.1.1/32"}) // config left untouched
+}
+
+func TestNewConfig_InvalidSourceIP(t *testing.T) {
+	is := is.New(t)
+	_, err := New(WithSourceIPs("1.1.1.1", "not-an-ip"))
+	var addrErr *InvalidAddressError
+	is.True(errors.As(err, &addrErr))
+}
+
+func TestNewConfig_InvalidIPLimit(t *testing.T) {
+	is := is.New(t)
+	_, err := New(WithIPLimit(0))
+	is.True(err != nil)
+	_, err = New(WithIPLimit(-1))
+	is.True(err != nil)
+}
+
+func TestNewFromFile_InvalidSourceIP(t *testing.T) {
+	is := is.New(t)
+	in := []byte(`
+name: firstname-lastname-firewall-rule
+ips:
+  - 1.1.1.1
+  - 1.1.1.1/32/32
+`)
+	_, err := LoadFromFile(bytes.NewBuffer(in))
+	var addrErr *InvalidAddressError
+	is.True(errors.As(err, &addrErr))
+}
+
+func TestParseIP(t *testing.T) {
+	tests := []struct {
+		description string
+		body        string
+		ipv6        bool
+		expect      string
+		expectErr   bool
+	}{
+		{
+			description: "IPv4 with trailing newline",
+			body:        "1.1.1.1\n",
+			expect:      "1.1.1.1",
+		},
+		{
+			description: "IPv6",
+			body:        "2001:DB8::1\n",
+			ipv6:        true,
+			expect:      "2001:db8::1",
+		},
+		{
+			description: "IPv6 when IPv4 requested",
+			body:        "2001:db8::1",
+			expectErr:   true,
+		},
+		{
+			description: "IPv4 when IPv6 requested",
+			body:        "1.1.1.1",
+			ipv6:        true,
+			expectErr:   true,
+		},
+		{
+			description: "captive portal",
+			body:        "<html><head><title>Welcome</title></head></html>",
+			expectErr:   true,
+		},
+		{
+			description: "empty body",
+			body:        "",
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			got, err := parseIP("https://example.com", tc.body, tc.ipv6)
+			if tc.expectErr {
+				var respErr *UnexpectedResponseError
+				is.True(errors.As(err, &respErr))
+				return
+			}
+			is.NoErr(err)
+			is.Equal(got, tc.expect)
+		})
+	}
+}
+
+func TestConfig_Owned(t *testing.T) {
+	is := is.New(t)
+
+	legacy, err := LoadFromFile(bytes.NewBufferString("name: fw\nips:\n  - 1.1.1.1\n"))
+	is.NoErr(err)
+	is.Equal(legacy.Owned(), []string{"1.1.1.1/32"}) // legacy configs own their source IPs
+
+	tracked, err := LoadFromFile(bytes.NewBufferString("name: fw\nips:\n  - 2.2.2.2\nmanaged:\n  - 1.1.1.1\n"))
+	is.NoErr(err)
+	is.Equal(tracked.Owned(), []string{"1.1.1.1/32"}) // managed IPs are normalized
+
+	_, err = LoadFromFile(bytes.NewBufferString("name: fw\nmanaged:\n  - not-an-ip\n"))
+	var invalid *InvalidAddressError
+	is.True(errors.As(err, &invalid))
+}
+
+func TestConfig_Allow(t *testing.T) {
+	is := is.New(t)
+	cfg := &Config{SourceIPs: []Entry{{IP: "1.1.1.1/32", Label: "home"}}}
+
+	is.NoErr(cfg.Allow("2.2.2.2", 2*time.Hour))
+	is.Equal(cfg.SourceIPs[1], Entry{IP: "2.2.2.2/32", AddedAt: testTime, LastSeenAt: testTime, ExpiresAt: testTime.Add(2 * time.Hour)})
+
+	// an existing IP keeps its metadata.
+	is.NoErr(cfg.Allow("1.1.1.1", time.Hour))
+	is.Equal(cfg.SourceIPs[0], Entry{IP: "1.1.1.1/32", Label: "home", ExpiresAt: testTime.Add(time.Hour)})
+
+	// and no longer expires without a duration.
+	is.NoErr(cfg.Allow("1.1.1.1", 0))
+	is.Equal(cfg.SourceIPs[0], Entry{IP: "1.1.1.1/32", Label: "home"})
+
+	var addrErr *InvalidAddressError
+	is.True(errors.As(cfg.Allow("not-an-ip", time.Hour), &addrErr))
+	is.True(errors.As(cfg.Allow("", time.Hour), &addrErr))
+	is.Equal(len(cfg.SourceIPs), 2)
+}
+
+func TestConfig_Add_Eviction(t *testing.T) {
+	tests := []struct {
+		description string
+		ips         []Entry
+		expectedIPs []string
+		expectErr   bool
+	}{
+		{
+			description: "least recently seen is evicted",
+			ips: []Entry{
+				{IP: "1.1.1.1/32", LastSeenAt: testTime.Add(-time.Hour)},
+				{IP: "2.2.2.2/32", LastSeenAt: testTime.Add(-3 * time.Hour)},
+				{IP: "3.3.3.3/32", LastSeenAt: testTime.Add(-2 * time.Hour)},
+			},
+			expectedIPs: []string{"1.1.1.1/32", "3.3.3.3/32", "4.4.4.4/32"},
+		},
+		{
+			description: "pinned is never evicted",
+			ips: []Entry{
+				{IP: "1.1.1.1/32", LastSeenAt: testTime.Add(-time.Hour)},
+				{IP: "2.2.2.2/32", LastSeenAt: testTime.Add(-3 * time.Hour), Pinned: true},
+				{IP: "3.3.3.3/32", LastSeenAt: testTime.Add(-2 * time.Hour)},
+			},
+			expectedIPs: []string{"1.1.1.1/32", "2.2.2.2/32", "4.4.4.4/32"},
+		},
+		{
+			description: "added is used when never seen",
+			ips: []Entry{
+				{IP: "1.1.1.1/32", LastSeenAt: testTime.Add(-time.Hour)},
+				{IP: "2.2.2.2/32", AddedAt: testTime.Add(-30 * time.Minute)},
+				{IP: "3.3.3.3/32", LastSeenAt: testTime.Add(-2 * time.Hour)},
+			},
+			expectedIPs: []string{"1.1.1.1/32", "2.2.2.2/32", "4.4.4.4/32"},
+		},
+		{
+			description: "every IP pinned",
+			ips: []Entry{
+				{IP: "1.1.1.1/32", Pinned: true},
+				{IP: "2.2.2.2/32", Pinned: true},
+				{IP: "3.3.3.3/32", Pinned: true},
+			},
+			expectedIPs: []string{"1.1.1.1/32", "2.2.2.2/32", "3.3.3.3/32"},
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			cfg := &Config{IPLimit: 3, SourceIPs: tc.ips}
+			err := cfg.Add("4.4.4.4")
+			is.Equal(err != nil, tc.expectErr)
+			is.Equal(cfg.IPs(), tc.expectedIPs)
+		})
+	}
+}
+
+func TestConfig_AddCurrent(t *testing.T) {
+	tests := []struct {
+		description string
+		limit       int
+		ips         []Entry
+		current     []string
+		expectedIPs []string
+		expectAdded bool
+		expectErr   bool
+	}{
+		{
+			description: "IPv4 and IPv6 are added together",
+			limit:       3,
+			ips:         []Entry{{IP: "1.1.1.1/32", LastSeenAt: testTime.Add(-time.Hour)}},
+			current:     []string{"2.2.2.2", "2001:db8::1"},
+			expectedIPs: []string{"1.1.1.1/32", "2.2.2.2/32", "2001:db8::1/128"},
+			expectAdded: true,
+		},
+		{
+			description: "older IPs make room",
+			limit:       2,
+			ips:         []Entry{{IP: "1.1.1.1/32", LastSeenAt: testTime.Add(-time.Hour)}},
+			current:     []string{"2.2.2.2", "2001:db8::1"},
+			expectedIPs: []string{"2.2.2.2/32", "2001:db8::1/128"},
+			expectAdded: true,
+		},
+		{
+			description: "already held",
+			limit:       2,
+			ips:         []Entry{{IP: "2.2.2.2/32"}, {IP: "2001:db8::1/128"}},
+			current:     []string{"2.2.2.2", "2001:db8::1"},
+			expectedIPs: []string{"2.2.2.2/32", "2001:db8::1/128"},
+		},
+		{
+			description: "IPv6 never evicts the IPv4 detected with it",
+			limit:       1,
+			ips:         []Entry{{IP: "2.2.2.2/32"}},
+			current:     []string{"2.2.2.2", "2001:db8::1"},
+			expectedIPs: []string{"2.2.2.2/32"},
+			expectErr:   true,
+		},
+		{
+			description: "pinned IPs and current IPs fill the limit",
+			limit:       2,
+			ips:         []Entry{{IP: "1.1.1.1/32", Pinned: true}},
+			current:     []string{"2.2.2.2", "2001:db8::1"},
+			expectedIPs: []string{"1.1.1.1/32", "2.2.2.2/32"},
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			cfg := &Config{IPLimit: tc.limit, SourceIPs: tc.ips}
+			added, err := cfg.AddCurrent(tc.current)
+			is.Equal(err != nil, tc.expectErr)
+			is.Equal(added, tc.expectAdded)
+			is.Equal(cfg.IPs(), tc.expectedIPs)
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// sharedAddressSpace is reserved for carrier-grade NAT by RFC 6598.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// overlayInterfaces are name prefixes of the interfaces of VPN overlays such as Tailscale, WireGuard and ZeroTier.
+// They assign addresses from the shared address space without carrier-grade NAT being involved.
+var overlayInterfaces = []string{"tailscale", "utun", "wg", "zt"}
+
+// proxyEnv are the environment variables configuring the HTTP proxy used by http resolvers.
+var proxyEnv = []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"}
+
+// localAddrs returns the addresses of the local network interfaces that are up by interface name, loopback
+// interfaces excluded. It is replaced in tests.
+var localAddrs = func() (map[string][]netip.Addr, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make(map[string][]netip.Addr)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		ifaceAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range ifaceAddrs {
+			if prefix, err := netip.ParsePrefix(a.String()); err == nil {
+				addrs[iface.Name] = append(addrs[iface.Name], prefix.Addr())
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// Warning describes why a detected public IP may not be what should be allowed on a firewall.
+type Warning struct {
+	Message string
+	// Unsafe is set when the IP should not be allowed without the user's consent, e.g. because it is shared
+	// with other customers of an ISP or belongs to a proxy.
+	Unsafe bool
+}
+
+// Detection is a detected public IP along with any warnings about allowing it on a firewall.
+type Detection struct {
+	IP       string
+	Warnings []Warning
+}
+
+// Unsafe reports whether any of the warnings is unsafe.
+func (d Detection) Unsafe() bool {
+	for _, w := range d.Warnings {
+		if w.Unsafe {
+			return true
+		}
+	}
+	return false
+}
+
+// proxied is implemented by resolvers that may query through an HTTP proxy.
+type proxied interface {
+	// proxy returns the proxy queries for the family go through, or nil if they are sent directly.
+	proxy(ipv6 bool) *url.URL
+}
+
+// Detect queries the resolvers like Consensus and checks whether the public IP is safe to allow on a firewall.
+// Resolvers going through an HTTP proxy answer with the proxy's address, so when their answer differs from the
+// answer of the direct resolvers the direct answer is used. If only resolvers going through a proxy answered,
+// their answer is returned with an unsafe warning. IPv4 addresses are also checked for carrier-grade NAT, which
+// shares the address with other customers of an ISP: an unsafe warning is returned if the address or the address
+// of a local interface is in the shared address space 100.64.0.0/10.
+func Detect(ctx context.Context, resolvers []Resolver, ipv6 bool) (Detection, error) {
+	var direct, viaProxy []Resolver
+	var proxies []string
+	for _, r := range resolvers {
+		if p, ok := r.(proxied); ok {
+			if u := p.proxy(ipv6); u != nil {
+				viaProxy = append(viaProxy, r)
+				if proxy := u.Redacted(); !slices.Contains(proxies, proxy) {
+					proxies = append(proxies, proxy)
+				}
+				continue
+			}
+		}
+		direct = append(direct, r)
+	}
+
+	var d Detection
+	if len(viaProxy) == 0 {
+		ip, err := Consensus(ctx, direct, ipv6)
+		if err != nil {
+			return Detection{}, err
+		}
+		d.IP = ip
+	} else {
+		var wg sync.WaitGroup
+		var directIP, proxiedIP string
+		var directErr, proxiedErr error
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			directIP, directErr = Consensus(ctx, direct, ipv6)
+		}()
+		go func() {
+			defer wg.Done()
+			proxiedIP, proxiedErr = Consensus(ctx, viaProxy, ipv6)
+		}()
+		wg.Wait()
+
+		proxy := describeProxies(proxies)
+		switch {
+		case directErr == nil:
+			d.IP = directIP
+			if proxiedErr == nil && proxiedIP != directIP {
+				d.Warnings = append(d.Warnings, Warning{Message: fmt.Sprintf(
+					"resolvers going through the HTTP proxy %s answered %s, using %s answered by direct resolvers",
+					proxy, proxiedIP, directIP)})
+			}
+		case proxiedErr == nil:
+			d.IP = proxiedIP
+			d.Warnings = append(d.Warnings, Warning{
+				Message: fmt.Sprintf("only detected through the HTTP proxy %s, it is likely the proxy's address: "+
+					"direct resolvers failed: %v", proxy, directErr),
+				Unsafe: true,
+			})
+		default:
+			return Detection{}, errors.Join(directErr, proxiedErr)
+		}
+	}
+
+	if !ipv6 {
+		d.Warnings = append(d.Warnings, sharedAddressWarnings(d.IP)...)
+	}
+	return d, nil
+}
+
+// sharedAddressWarnings returns an unsafe warning if ip or the address of a local interface is in the shared
+// address space used by carrier-grade NAT. Interfaces of VPN overlays are ignored.
+func sharedAddressWarnings(ip string) []Warning {
+	if addr, err := netip.ParseAddr(ip); err == nil && sharedAddressSpace.Contains(addr) {
+		return []Warning{{
+			Message: fmt.Sprintf("address is in the range %s used by carrier-grade NAT, "+
+				"it is shared with other customers of your ISP", sharedAddressSpace),
+			Unsafe: true,
+		}}
+	}
+
+	addrs, err := localAddrs()
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(addrs))
+	for name := range addrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if isOverlay(name) {
+			continue
+		}
+		for _, addr := range addrs[name] {
+			if sharedAddressSpace.Contains(addr.Unmap()) {
+				return []Warning{{
+					Message: fmt.Sprintf("interface %s has the address %s in the range %s used by carrier-grade NAT, "+
+						"your public IP is likely shared with other customers of your ISP", name, addr, sharedAddressSpace),
+					Unsafe: true,
+				}}
+			}
+		}
+	}
+	return nil
+}
+
+func isOverlay(name string) bool {
+	for _, prefix := range overlayInterfaces {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeProxies lists the proxies along with the environment variables configuring them.
+func describeProxies(proxies []string) string {
+	var set []string
+	for _, env := range proxyEnv {
+		if os.Getenv(env) != "" {
+			set = append(set, env)
+		}
+	}
+	if len(set) == 0 {
+		return strings.Join(proxies, ", ")
+	}
+	return fmt.Sprintf("%s (set by %s)", strings.Join(proxies, ", "), strings.Join(set, ", "))
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+// proxiedResolver returns a resolver querying through a proxy that answers every request with the proxy's address.
+func proxiedResolver(t *testing.T, address string) *HTTPResolver {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, address)
+	}))
+	t.Cleanup(proxy.Close)
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	return &HTTPResolver{
+		IPv4:   "http://ip.example.com",
+		Client: &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}},
+	}
+}
+
+func TestDetect_Proxy(t *testing.T) {
+	tests := []struct {
+		description string
+		resolvers   func(t *testing.T) []Resolver
+		expect      string
+		warning     bool
+		unsafe      bool
+	}{
+		{
+			description: "no proxy",
+			resolvers: func(t *testing.T) []Resolver {
+				return []Resolver{&HTTPResolver{IPv4: ipServer(t, "1.1.1.1")}, &HTTPResolver{IPv4: ipServer(t, "1.1.1.1")}}
+			},
+			expect: "1.1.1.1",
+		},
+		{
+			description: "proxied and direct agree",
+			resolvers: func(t *testing.T) []Resolver {
+				return []Resolver{proxiedResolver(t, "1.1.1.1"), &HTTPResolver{IPv4: ipServer(t, "1.1.1.1")}}
+			},
+			expect: "1.1.1.1",
+		},
+		{
+			description: "proxied and direct differ",
+			resolvers: func(t *testing.T) []Resolver {
+				return []Resolver{
+					proxiedResolver(t, "6.6.6.6"),
+					proxiedResolver(t, "6.6.6.6"),
+					proxiedResolver(t, "6.6.6.6"),
+					&HTTPResolver{IPv4: ipServer(t, "1.1.1.1")},
+				}
+			},
+			expect:  "1.1.1.1",
+			warning: true,
+		},
+		{
+			description: "only proxied answered",
+			resolvers: func(t *testing.T) []Resolver {
+				return []Resolver{proxiedResolver(t, "6.6.6.6"), &HTTPResolver{IPv4: ipServer(t, "")}}
+			},
+			expect:  "6.6.6.6",
+			warning: true,
+			unsafe:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			d, err := Detect(context.Background(), tc.resolvers(t), false)
+			is.NoErr(err)
+			is.Equal(d.IP, tc.expect)
+			is.Equal(len(d.Warnings) > 0, tc.warning)
+			is.Equal(d.Unsafe(), tc.unsafe)
+		})
+	}
+}
+
+func TestDetect_CGNAT(t *testing.T) {
+	defer func(orig func() (map[string][]netip.Addr, error)) { localAddrs = orig }(localAddrs)
+
+	tests := []struct {
+		description string
+		answer      string
+		ipv6        bool
+		addrs       map[string][]netip.Addr
+		unsafe      bool
+	}{
+		{
+			description: "private network",
+			answer:      "1.1.1.1",
+			addrs:       map[string][]netip.Addr{"eth0": {netip.MustParseAddr("192.168.1.10")}},
+		},
+		{
+			description: "shared address on interface",
+			answer:      "1.1.1.1",
+			addrs:       map[string][]netip.Addr{"wwan0": {netip.MustParseAddr("100.72.3.4")}},
+			unsafe:      true,
+		},
+		{
+			description: "shared address on VPN overlay",
+			answer:      "1.1.1.1",
+			addrs:       map[string][]netip.Addr{"tailscale0": {netip.MustParseAddr("100.101.102.103")}},
+		},
+		{
+			description: "shared address detected",
+			answer:      "100.64.0.1",
+			unsafe:      true,
+		},
+		{
+			description: "IPv6 is not affected",
+			answer:      "2001:db8::1",
+			ipv6:        true,
+			addrs:       map[string][]netip.Addr{"wwan0": {netip.MustParseAddr("100.72.3.4")}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			localAddrs = func() (map[string][]netip.Addr, error) { return tc.addrs, nil }
+
+			r := &HTTPResolver{IPv4: ipServer(t, tc.answer)}
+			if tc.ipv6 {
+				r = &HTTPResolver{IPv6: ipServer(t, tc.answer)}
+			}
+			d, err := Detect(context.Background(), []Resolver{r}, tc.ipv6)
+			is.NoErr(err)
+			is.Equal(d.IP, tc.answer)
+			is.Equal(d.Unsafe(), tc.unsafe)
+		})
+	}
+}
+
+func TestDescribeProxies(t *testing.T) {
+	is := is.New(t)
+	for _, env := range proxyEnv {
+		t.Setenv(env, "")
+	}
+	is.Equal(describeProxies([]string{"http://proxy:3128"}), "http://proxy:3128")
+
+	t.Setenv("HTTPS_PROXY", "http://proxy:3128")
+	is.True(strings.HasSuffix(describeProxies([]string{"http://proxy:3128"}), "(set by HTTPS_PROXY)"))
+}
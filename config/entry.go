@@ -0,0 +1,64 @@
+package config
+
+import (
+	"time"
+)
+
+// now returns the current time, it is replaced in tests.
+var now = func() time.Time {
+	return time.Now().UTC()
+}
+
+// Entry is an allowed IP along with metadata describing it.
+type Entry struct {
+	// IP in its canonical CIDR form.
+	IP string `yaml:"ip"`
+	// Label names the network the IP belongs to, e.g. home or office.
+	Label string `yaml:"label,omitempty"`
+	// AddedAt is when the IP was added. It is unknown for IPs added before fwsync recorded it.
+	AddedAt time.Time `yaml:"added_at,omitempty"`
+	// LastSeenAt is when the IP was last detected as your public IP.
+	LastSeenAt time.Time `yaml:"last_seen_at,omitempty"`
+	// ExpiresAt is when the IP is no longer allowed. The IP does not expire at a fixed time if zero.
+	ExpiresAt time.Time `yaml:"expires_at,omitempty"`
+	// Note is free text attached to the IP, e.g. why it was allowed.
+	Note string `yaml:"note,omitempty"`
+	// Pinned IPs are never evicted to make room for new IPs and don't expire with age.
+	Pinned bool `yaml:"pinned,omitempty"`
+}
+
+// Expired reports whether the entry expired at the given time. An entry expires once at reaches ExpiresAt,
+// or once maxAge passed since it was last seen unless it is pinned. Entries never seen, e.g. ones written
+// before fwsync recorded it, fall back to when they were added and don't expire with age if that is unknown as well.
+func (e Entry) Expired(at time.Time, maxAge time.Duration) bool {
+	if !e.ExpiresAt.IsZero() && !at.Before(e.ExpiresAt) {
+		return true
+	}
+	if maxAge <= 0 || e.Pinned {
+		return false
+	}
+	seen := e.seen()
+	return !seen.IsZero() && at.Sub(seen) >= maxAge
+}
+
+// seen returns when the entry was last seen, falling back to when it was added.
+func (e Entry) seen() time.Time {
+	if e.LastSeenAt.IsZero() {
+		return e.AddedAt
+	}
+	return e.LastSeenAt
+}
+
+// UnmarshalYAML reads an Entry. Configuration files written before entries carried metadata
+// hold a plain IP, it is read as an Entry without metadata.
+func (e *Entry) UnmarshalYAML(unmarshal func(any) error) error {
+	var ip string
+	if err := unmarshal(&ip); err == nil {
+		*e = Entry{IP: ip}
+		return nil
+	}
+
+	// entry has no UnmarshalYAML method, avoiding infinite recursion.
+	type entry Entry
+	return unmarshal((*entry)(e))
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestEntry_UnmarshalYAML(t *testing.T) {
+	in := []byte(`
+name: firstname-lastname-firewall-rule
+ips:
+  - 1.1.1.1
+  - ip: 2.2.2.2
+    label: office
+    added_at: 2024-04-01T08:00:00Z
+    last_seen_at: 2024-04-30T17:00:00Z
+    note: static IP
+`)
+	is := is.New(t)
+	cfg, err := LoadFromFile(bytes.NewBuffer(in))
+	is.NoErr(err)
+	is.Equal(cfg.SourceIPs, []Entry{
+		{IP: "1.1.1.1/32"}, // plain IPs migrate to entries without metadata
+		{
+			IP:         "2.2.2.2/32",
+			Label:      "office",
+			AddedAt:    time.Date(2024, 4, 1, 8, 0, 0, 0, time.UTC),
+			LastSeenAt: time.Date(2024, 4, 30, 17, 0, 0, 0, time.UTC),
+			Note:       "static IP",
+		},
+	})
+}
+
+func TestConfig_Seen(t *testing.T) {
+	is := is.New(t)
+	cfg := &Config{SourceIPs: entries("1.1.1.1/32", "2.2.2.2/32")}
+
+	is.True(cfg.Seen("2.2.2.2"))
+	is.Equal(cfg.SourceIPs, []Entry{{IP: "1.1.1.1/32"}, {IP: "2.2.2.2/32", LastSeenAt: testTime}})
+
+	is.True(!cfg.Seen("3.3.3.3"))
+}
+
+func TestConfig_Entry(t *testing.T) {
+	is := is.New(t)
+	cfg := &Config{SourceIPs: entries("1.1.1.1/32")}
+
+	entry := cfg.Entry("1.1.1.1")
+	is.True(entry != nil)
+	entry.Label = "home"
+	is.Equal(cfg.SourceIPs[0].Label, "home") // modified in place
+
+	is.Equal(cfg.Entry("2.2.2.2"), nil)
+}
+
+func TestEntry_Expired(t *testing.T) {
+	tests := []struct {
+		description string
+		entry       Entry
+		maxAge      time.Duration
+		expect      bool
+	}{
+		{
+			description: "no expiry",
+			entry:       Entry{IP: "1.1.1.1/32", LastSeenAt: testTime.Add(-1000 * time.Hour)},
+			expect:      false,
+		},
+		{
+			description: "expires in the future",
+			entry:       Entry{IP: "1.1.1.1/32", ExpiresAt: testTime.Add(time.Minute)},
+			expect:      false,
+		},
+		{
+			description: "expires now",
+			entry:       Entry{IP: "1.1.1.1/32", ExpiresAt: testTime},
+			expect:      true,
+		},
+		{
+			description: "seen within max age",
+			entry:       Entry{IP: "1.1.1.1/32", LastSeenAt: testTime.Add(-time.Hour)},
+			maxAge:      2 * time.Hour,
+			expect:      false,
+		},
+		{
+			description: "not seen within max age",
+			entry:       Entry{IP: "1.1.1.1/32", AddedAt: testTime.Add(-time.Hour), LastSeenAt: testTime.Add(-3 * time.Hour)},
+			maxAge:      2 * time.Hour,
+			expect:      true,
+		},
+		{
+			description: "never seen, added before max age",
+			entry:       Entry{IP: "1.1.1.1/32", AddedAt: testTime.Add(-3 * time.Hour)},
+			maxAge:      2 * time.Hour,
+			expect:      true,
+		},
+		{
+			description: "no timestamps",
+			entry:       Entry{IP: "1.1.1.1/32"},
+			maxAge:      2 * time.Hour,
+			expect:      false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(tc.entry.Expired(testTime, tc.maxAge), tc.expect)
+		})
+	}
+}
+
+func TestConfig_Prune(t *testing.T) {
+	in := []byte(`
+name: firstname-lastname-firewall-rule
+max_age: 168h
+ips:
+  - ip: 1.1.1.1
+    last_seen_at: 2024-04-01T12:00:00Z
+  - ip: 2.2.2.2
+    last_seen_at: 2024-04-30T12:00:00Z
+  - ip: 3.3.3.3
+    last_seen_at: 2024-04-30T12:00:00Z
+    expires_at: 2024-05-01T00:00:00Z
+  - 4.4.4.4
+`)
+	is := is.New(t)
+	cfg, err := LoadFromFile(bytes.NewBuffer(in))
+	is.NoErr(err)
+	is.Equal(cfg.MaxAge, 7*24*time.Hour)
+
+	is.Equal(cfg.Prune(), []string{"1.1.1.1/32", "3.3.3.3/32"})
+	is.Equal(cfg.IPs(), []string{"2.2.2.2/32", "4.4.4.4/32"})
+
+	is.Equal(len(cfg.Prune()), 0) // nothing left to prune
+}
+
+func TestEntry_Expired_Pinned(t *testing.T) {
+	is := is.New(t)
+	entry := Entry{IP: "1.1.1.1/32", LastSeenAt: testTime.Add(-3 * time.Hour), Pinned: true}
+	is.True(!entry.Expired(testTime, time.Hour)) // pinned IPs don't expire with age
+
+	entry.ExpiresAt = testTime
+	is.True(entry.Expired(testTime, time.Hour)) // but do at a fixed time
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultProfile is the name given to the profile of a configuration file written before
+// fwsync supported profiles, and to the first profile when none is named.
+const DefaultProfile = "default"
+
+// File describes the .fwsync configuration file. It holds one Config per named profile.
+type File struct {
+	// Default is the profile used when none is selected.
+	Default  string             `yaml:"default,omitempty"`
+	Profiles map[string]*Config `yaml:"profiles"`
+	// Resolvers detect the public IP shared by every profile. The DefaultResolvers are used if empty.
+	Resolvers []ResolverConfig `yaml:"resolvers,omitempty"`
+}
+
+// NewFile returns an empty configuration file.
+func NewFile() *File {
+	return &File{Profiles: make(map[string]*Config)}
+}
+
+// LoadFile reads the .fwsync configuration file. Files written before fwsync supported profiles
+// hold a single Config at the top level, it is loaded as the DefaultProfile.
+// Every source IP is validated and converted to its canonical CIDR form, and every resolver is validated.
+func LoadFile(r io.Reader) (*File, error) {
+	in, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	file := NewFile()
+	if err := yaml.Unmarshal(in, file); err != nil {
+		return nil, err
+	}
+
+	if len(file.Profiles) == 0 {
+		// single profile file, migrate it to the default profile.
+		legacy := &Config{}
+		if err := yaml.Unmarshal(in, legacy); err != nil {
+			return nil, err
+		}
+		if legacy.Provider == "" && legacy.Name == "" {
+			return nil, fmt.Errorf("configuration file has no profiles")
+		}
+		file = NewFile()
+		file.Set(DefaultProfile, legacy)
+	}
+
+	for name, cfg := range file.Profiles {
+		if cfg == nil {
+			return nil, fmt.Errorf("profile: %s is empty", name)
+		}
+		cfg.Profile = name
+		if err := cfg.normalize(); err != nil {
+			return nil, fmt.Errorf("profile: %s: %w", name, err)
+		}
+	}
+	if _, err := file.resolvers(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Profile returns the named profile. The Default profile is returned if name is empty.
+func (f *File) Profile(name string) (*Config, error) {
+	if name == "" {
+		name = f.Default
+	}
+	if name == "" {
+		name = DefaultProfile
+	}
+	cfg, ok := f.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile: %s not found, available profiles: %v", name, f.Names())
+	}
+	return cfg, nil
+}
+
+// Set adds or replaces the named profile. The first profile added becomes the Default.
+func (f *File) Set(name string, cfg *Config) {
+	if f.Profiles == nil {
+		f.Profiles = make(map[string]*Config)
+	}
+	cfg.Profile = name
+	f.Profiles[name] = cfg
+	if f.Default == "" {
+		f.Default = name
+	}
+}
+
+// Names returns the names of all profiles in alphabetical order.
+func (f *File) Names() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PublicIPs detects the current public IPs with the file's resolvers, see the package level PublicIPs.
+func (f *File) PublicIPs() ([]string, error) {
+	resolvers, err := f.resolvers()
+	if err != nil {
+		return nil, err
+	}
+	return PublicIPs(resolvers...)
+}
+
+// DetectPublicIPs detects the current public IPs with the file's resolvers, see the package level DetectPublicIPs.
+func (f *File) DetectPublicIPs() ([]Detection, error) {
+	resolvers, err := f.resolvers()
+	if err != nil {
+		return nil, err
+	}
+	return DetectPublicIPs(resolvers...)
+}
+
+func (f *File) resolvers() ([]Resolver, error) {
+	resolvers := make([]Resolver, 0, len(f.Resolvers))
+	for i, rc := range f.Resolvers {
+		r, err := rc.Resolver()
+		if err != nil {
+			return nil, fmt.Errorf("resolver: %d: %w", i, err)
+		}
+		resolvers = append(resolvers, r)
+	}
+	return resolvers, nil
+}
+
+// Write will write the configuration file from memory to disk.
+func (f *File) Write(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	err := enc.Encode(f)
+	defer enc.Close()
+	return err
+}
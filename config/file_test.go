@@ -0,0 +1,103 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestLoadFile(t *testing.T) {
+	in := []byte(`
+default: dev
+profiles:
+  dev:
+    provider: google
+    project: my-project
+    name: dev-vm
+    ips:
+      - 1.1.1.1
+  side-project:
+    provider: linode
+    name: side-project-fw
+    ips:
+      - 2001:db8::1
+`)
+	is := is.New(t)
+	file, err := LoadFile(bytes.NewBuffer(in))
+	is.NoErr(err)
+	is.Equal(file.Names(), []string{"dev", "side-project"})
+
+	dev, err := file.Profile("")
+	is.NoErr(err)
+	is.Equal(dev, &Config{Provider: "google", Project: "my-project", Name: "dev-vm", SourceIPs: entries("1.1.1.1/32"), Profile: "dev"})
+
+	side, err := file.Profile("side-project")
+	is.NoErr(err)
+	is.Equal(side.IPs(), []string{"2001:db8::1/128"})
+
+	_, err = file.Profile("missing")
+	is.Equal(err.Error(), "profile: missing not found, available profiles: [dev side-project]")
+}
+
+func TestLoadFile_Legacy(t *testing.T) {
+	in := []byte(`
+provider: google
+project: my-project
+name: firstname-lastname-firewall-rule
+ips:
+  - 1.1.1.1
+`)
+	is := is.New(t)
+	file, err := LoadFile(bytes.NewBuffer(in))
+	is.NoErr(err)
+	is.Equal(file.Default, DefaultProfile)
+	is.Equal(file.Names(), []string{DefaultProfile})
+
+	cfg, err := file.Profile("")
+	is.NoErr(err)
+	is.Equal(cfg, &Config{Provider: "google", Project: "my-project", Name: "firstname-lastname-firewall-rule", SourceIPs: entries("1.1.1.1/32"), Profile: DefaultProfile})
+
+	// once written the file holds profiles.
+	out := &bytes.Buffer{}
+	is.NoErr(file.Write(out))
+	migrated, err := LoadFile(out)
+	is.NoErr(err)
+	is.Equal(migrated, file)
+}
+
+func TestLoadFile_Invalid(t *testing.T) {
+	tests := []struct {
+		description string
+		in          string
+	}{
+		{description: "empty file", in: ""},
+		{description: "empty profile", in: "profiles:\n  dev:\n"},
+		{description: "invalid source IP", in: "profiles:\n  dev:\n    name: dev-vm\n    ips:\n      - not-an-ip\n"},
+		{description: "negative ip limit", in: "profiles:\n  dev:\n    name: dev-vm\n    ip_limit: -1\n"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			_, err := LoadFile(bytes.NewBufferString(tc.in))
+			is.True(err != nil)
+		})
+	}
+}
+
+func TestFile_Set(t *testing.T) {
+	is := is.New(t)
+	file := NewFile()
+
+	file.Set("dev", &Config{Name: "dev-vm"})
+	file.Set("side-project", &Config{Name: "side-project-fw"})
+	is.Equal(file.Default, "dev") // first profile becomes the default
+
+	file.Set("dev", &Config{Name: "new-dev-vm"})
+	cfg, err := file.Profile("dev")
+	is.NoErr(err)
+	is.Equal(cfg.Name, "new-dev-vm")
+	is.Equal(cfg.Profile, "dev")
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"io"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// historyLimit is the number of changes kept in the history, older changes are dropped.
+const historyLimit = 100
+
+// Change is a change fwsync applied to a firewall.
+type Change struct {
+	Time     time.Time `yaml:"time"`
+	Profile  string    `yaml:"profile"`
+	Provider string    `yaml:"provider"`
+	Firewall string    `yaml:"firewall"`
+	// Previous holds the source ranges on the firewall before the change.
+	Previous []string `yaml:"previous"`
+	// Current holds the source ranges written by the change.
+	Current []string `yaml:"current"`
+	// PreviousManaged holds the ranges fwsync managed on the firewall before the change, see Config.Managed.
+	PreviousManaged []string `yaml:"previous_managed"`
+}
+
+// History describes the .fwsync_history file. It holds the changes applied to firewalls, oldest first.
+type History struct {
+	Changes []Change `yaml:"changes"`
+}
+
+// LoadHistory reads the .fwsync_history file. An empty file holds no changes.
+func LoadHistory(r io.Reader) (*History, error) {
+	history := &History{}
+	err := yaml.NewDecoder(r).Decode(history)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return history, nil
+}
+
+// Record adds a change to the history. Only the most recent changes are kept.
+func (h *History) Record(change Change) {
+	h.Changes = append(h.Changes, change)
+	if len(h.Changes) > historyLimit {
+		h.Changes = h.Changes[len(h.Changes)-historyLimit:]
+	}
+}
+
+// Recent returns the nth most recent change, starting at 1. It returns false if there is no such change.
+func (h *History) Recent(n int) (Change, bool) {
+	if n < 1 || n > len(h.Changes) {
+		return Change{}, false
+	}
+	return h.Changes[len(h.Changes)-n], true
+}
+
+// Restored records that fwsync manages the ranges it managed before the change, after the firewall was restored.
+func (c *Config) Restored(change Change) {
+	c.Managed = slices.Clone(change.PreviousManaged)
+}
+
+// Write will write the history from memory to disk.
+func (h *History) Write(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	err := enc.Encode(h)
+	defer enc.Close()
+	return err
+}
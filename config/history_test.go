@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestHistory(t *testing.T) {
+	is := is.New(t)
+
+	history, err := LoadHistory(bytes.NewBuffer(nil))
+	is.NoErr(err)
+	is.Equal(len(history.Changes), 0) // empty file holds no changes
+
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	history.Record(Change{Time: at, Profile: "dev", Provider: "google", Firewall: "dev-vm",
+		Previous: []string{"1.1.1.1/32"}, Current: []string{"2.2.2.2/32"}, PreviousManaged: []string{}})
+	history.Record(Change{Time: at.Add(time.Hour), Profile: "dev", Provider: "google", Firewall: "dev-vm",
+		Previous: []string{"2.2.2.2/32"}, Current: []string{"3.3.3.3/32"}, PreviousManaged: []string{"2.2.2.2/32"}})
+
+	latest, ok := history.Recent(1)
+	is.True(ok)
+	is.Equal(latest.Current, []string{"3.3.3.3/32"})
+	oldest, ok := history.Recent(2)
+	is.True(ok)
+	is.Equal(oldest.Previous, []string{"1.1.1.1/32"})
+	_, ok = history.Recent(3)
+	is.True(!ok)
+	_, ok = history.Recent(0)
+	is.True(!ok)
+
+	out := &bytes.Buffer{}
+	is.NoErr(history.Write(out))
+	loaded, err := LoadHistory(out)
+	is.NoErr(err)
+	is.Equal(loaded, history) // nothing managed round-trips as empty, not as the legacy nil
+}
+
+func TestHistory_Limit(t *testing.T) {
+	is := is.New(t)
+	history := &History{}
+	for i := 0; i < historyLimit+5; i++ {
+		history.Record(Change{Firewall: fmt.Sprintf("fw-%d", i)})
+	}
+	is.Equal(len(history.Changes), historyLimit)
+	is.Equal(history.Changes[0].Firewall, "fw-5") // oldest dropped
+}
+
+func TestConfig_Restored(t *testing.T) {
+	tests := []struct {
+		description string
+		managed     []string
+		change      Change
+		expect      []string
+	}{
+		{
+			description: "ranges managed before the change are managed again",
+			managed:     []string{"3.3.3.3/32"},
+			change: Change{
+				Previous:        []string{"10.0.0.0/8", "1.1.1.1/32", "2.2.2.2/32"},
+				Current:         []string{"10.0.0.0/8", "2.2.2.2/32", "3.3.3.3/32"},
+				PreviousManaged: []string{"1.1.1.1/32", "2.2.2.2/32"},
+			},
+			expect: []string{"1.1.1.1/32", "2.2.2.2/32"},
+		},
+		{
+			description: "nothing was managed before the change",
+			managed:     []string{"3.3.3.3/32"},
+			change: Change{
+				Previous:        []string{"10.0.0.0/8"},
+				Current:         []string{"10.0.0.0/8", "3.3.3.3/32"},
+				PreviousManaged: []string{},
+			},
+			expect: []string{},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			cfg := &Config{Managed: tc.managed}
+			cfg.Restored(tc.change)
+			is.Equal(cfg.Managed, tc.expect)
+		})
+	}
+}
@@ -1,41 +1,116 @@
 package config
 
-type configOpts func(*Config)
+import (
+	"fmt"
+	"time"
+)
+
+type configOpts func(*Config) error
 
 // WithProvider sets the Provider for the fwsync configuration.
 func WithProvider(provider string) configOpts {
-	return func(cfg *Config) {
+	return func(cfg *Config) error {
 		cfg.Provider = provider
+		return nil
 	}
 }
 
 // WithProject sets the Project for the fwsync configuration.
 func WithProject(project string) configOpts {
-	return func(cfg *Config) {
+	return func(cfg *Config) error {
 		cfg.Project = project
+		return nil
+	}
+}
+
+// WithRegion sets the Region for the fwsync configuration.
+func WithRegion(region string) configOpts {
+	return func(cfg *Config) error {
+		cfg.Region = region
+		return nil
+	}
+}
+
+// WithSubscription sets the Subscription for the fwsync configuration.
+func WithSubscription(subscription string) configOpts {
+	return func(cfg *Config) error {
+		cfg.Subscription = subscription
+		return nil
+	}
+}
+
+// WithResourceGroup sets the ResourceGroup for the fwsync configuration.
+func WithResourceGroup(resourceGroup string) configOpts {
+	return func(cfg *Config) error {
+		cfg.ResourceGroup = resourceGroup
+		return nil
 	}
 }
 
 // WithFirewall sets the Firewall's name in the fwsync configuration.
 func WithFirewall(name string) configOpts {
-	return func(cfg *Config) {
+	return func(cfg *Config) error {
 		cfg.Name = name
+		return nil
+	}
+}
+
+// WithRule sets the name of the managed rule on the Firewall in the fwsync configuration.
+func WithRule(rule string) configOpts {
+	return func(cfg *Config) error {
+		cfg.Rule = rule
+		return nil
+	}
+}
+
+// WithMaxAge sets how long IPs stay allowed after they were last seen in the fwsync configuration.
+func WithMaxAge(maxAge time.Duration) configOpts {
+	return func(cfg *Config) error {
+		cfg.MaxAge = maxAge
+		return nil
 	}
 }
 
-// WithSourceIPs sets the allowed IPs in the fwsync configuration.
+// WithSourceIPs sets the allowed IPs in the fwsync configuration in their canonical CIDR form,
+// recording them as added and seen now.
+// IPv6 addresses are widened to the prefix set by WithIPv6Prefix, so that option should be applied first.
+// An *InvalidAddressError is returned if any IP is not a valid IP address or CIDR range.
 func WithSourceIPs(sourceIPs ...string) configOpts {
-	return func(cfg *Config) {
+	return func(cfg *Config) error {
 		if len(sourceIPs) > cfg.IPLimit {
 			sourceIPs = sourceIPs[:cfg.IPLimit]
 		}
-		cfg.SourceIPs = sourceIPs
+		at := now()
+		entries := make([]Entry, 0, len(sourceIPs))
+		for _, ip := range sourceIPs {
+			cidr, err := cfg.Normalize(ip)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, Entry{IP: cidr, AddedAt: at, LastSeenAt: at})
+		}
+		if len(entries) > 0 {
+			cfg.SourceIPs = entries
+		}
+		return nil
+	}
+}
+
+// WithIPv6Prefix sets the prefix length IPv6 addresses are widened to on the firewall.
+func WithIPv6Prefix(bits int) configOpts {
+	return func(cfg *Config) error {
+		cfg.IPv6Prefix = bits
+		return nil
 	}
 }
 
 // WithIPLimit sets the number of allowed IPs.
 func WithIPLimit(limit int) configOpts {
-	return func(cfg *Config) {
+	return func(cfg *Config) error {
+		if limit < 1 {
+			return fmt.Errorf("invalid ip limit: %d, must be at least 1", limit)
+		}
 		cfg.IPLimit = limit
+		return nil
 	}
 }
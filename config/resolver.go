@@ -0,0 +1,186 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrFamilyUnsupported is returned by a Resolver that cannot detect addresses of the requested family.
+var ErrFamilyUnsupported = errors.New("address family not supported by resolver")
+
+// Resolver detects the public IP address of this host.
+type Resolver interface {
+	// Resolve returns the public IPv4 address, or the IPv6 address if ipv6 is set, in its canonical form.
+	Resolve(ctx context.Context, ipv6 bool) (string, error)
+	// String names the resolver in errors.
+	String() string
+}
+
+// DefaultResolvers are queried when the configuration file lists no resolvers.
+var DefaultResolvers = []Resolver{
+	&HTTPResolver{IPv4: "https://ipv4.icanhazip.com", IPv6: "https://ipv6.icanhazip.com"},
+	&HTTPResolver{IPv4: "https://api.ipify.org", IPv6: "https://api6.ipify.org"},
+	&HTTPResolver{IPv4: "https://v4.ident.me", IPv6: "https://v6.ident.me"},
+	&HTTPResolver{IPv4: "https://checkip.amazonaws.com"},
+	// resolver1.opendns.com and resolver1.ipv6-sandbox.opendns.com.
+	&DNSResolver{Name: "myip.opendns.com", IPv4: "208.67.222.222:53", IPv6: "[2620:0:ccc::2]:53"},
+	// ns1.google.com.
+	&DNSResolver{Name: "o-o.myaddr.l.google.com", TXT: true, IPv4: "216.239.32.10:53", IPv6: "[2001:4860:4802:32::a]:53"},
+	&STUNResolver{IPv4: "stun.l.google.com:19302", IPv6: "stun.l.google.com:19302"},
+	&STUNResolver{IPv4: "stun.cloudflare.com:3478", IPv6: "stun.cloudflare.com:3478"},
+}
+
+// NoConsensusError is returned when the resolvers disagree on the public IP and no address was
+// returned by a majority of the resolvers that answered.
+type NoConsensusError struct {
+	// Answers maps each address to the resolvers that returned it.
+	Answers map[string][]string
+}
+
+func (e *NoConsensusError) Error() string {
+	ips := make([]string, 0, len(e.Answers))
+	for ip := range e.Answers {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	answers := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		answers = append(answers, fmt.Sprintf("%s (%s)", ip, strings.Join(e.Answers[ip], ", ")))
+	}
+	return fmt.Sprintf("resolvers disagree on the public IP: %s", strings.Join(answers, ", "))
+}
+
+// SingleAnswerError is returned when only one of several resolvers answered. The address can't be checked
+// against another answer, so it is not used.
+type SingleAnswerError struct {
+	IP       string
+	Resolver string
+	// Err holds why the other resolvers failed.
+	Err error
+}
+
+func (e *SingleAnswerError) Error() string {
+	return fmt.Sprintf("only %s answered the public IP %s, at least two resolvers must agree: %v", e.Resolver, e.IP, e.Err)
+}
+
+func (e *SingleAnswerError) Unwrap() error {
+	return e.Err
+}
+
+// Consensus queries the resolvers in parallel and returns the address returned by a majority of the resolvers
+// that answered, and by at least two unless only one supports the family. Once a majority of all resolvers agree
+// the remaining queries are cancelled. A *NoConsensusError or *SingleAnswerError is returned otherwise.
+func Consensus(ctx context.Context, resolvers []Resolver, ipv6 bool) (string, error) {
+	if len(resolvers) == 0 {
+		return "", errors.New("no resolvers configured")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type answer struct {
+		resolver Resolver
+		ip       string
+		err      error
+	}
+	// buffered so resolvers answering after a majority was found don't block.
+	answers := make(chan answer, len(resolvers))
+	for _, r := range resolvers {
+		go func() {
+			ip, err := r.Resolve(ctx, ipv6)
+			answers <- answer{resolver: r, ip: ip, err: err}
+		}()
+	}
+
+	votes := make(map[string][]string)
+	answered := 0
+	// resolvers supporting the address family.
+	supported := len(resolvers)
+	var errs []error
+	for range resolvers {
+		a := <-answers
+		if a.err != nil {
+			if errors.Is(a.err, ErrFamilyUnsupported) {
+				supported--
+			} else {
+				errs = append(errs, a.err)
+			}
+			continue
+		}
+
+		answered++
+		votes[a.ip] = append(votes[a.ip], a.resolver.String())
+		if len(votes[a.ip]) > len(resolvers)/2 {
+			return a.ip, nil
+		}
+	}
+
+	if answered == 0 {
+		if len(errs) == 0 {
+			return "", ErrFamilyUnsupported
+		}
+		return "", errors.Join(errs...)
+	}
+	if answered == 1 && supported > 1 {
+		for ip, names := range votes {
+			return "", &SingleAnswerError{IP: ip, Resolver: names[0], Err: errors.Join(errs...)}
+		}
+	}
+	for ip, names := range votes {
+		if len(names) > answered/2 {
+			return ip, nil
+		}
+	}
+	return "", &NoConsensusError{Answers: votes}
+}
+
+// ResolverConfig describes a Resolver in the configuration file.
+type ResolverConfig struct {
+	// Type of the resolver, http, dns or stun. Defaults to http.
+	Type string `yaml:"type,omitempty"`
+	// IPv4 and IPv6 are the URLs queried by an http resolver, or the servers queried by a dns or stun resolver.
+	// At least one of them must be set.
+	IPv4 string `yaml:"ipv4,omitempty"`
+	IPv6 string `yaml:"ipv6,omitempty"`
+	// Name queried by a dns resolver.
+	Name string `yaml:"name,omitempty"`
+	// Record queried by a dns resolver, a for A or AAAA records depending on the family, or txt. Defaults to a.
+	Record string `yaml:"record,omitempty"`
+	// Protocol used by a dns resolver, udp or tcp. Defaults to udp.
+	Protocol string `yaml:"protocol,omitempty"`
+}
+
+// Resolver returns the Resolver described by the configuration.
+func (rc ResolverConfig) Resolver() (Resolver, error) {
+	switch rc.Type {
+	case "", "http":
+		r := &HTTPResolver{IPv4: rc.IPv4, IPv6: rc.IPv6}
+		return r, r.validate()
+	case "dns":
+		r := &DNSResolver{Name: rc.Name, IPv4: rc.IPv4, IPv6: rc.IPv6}
+		switch rc.Record {
+		case "", "a":
+		case "txt":
+			r.TXT = true
+		default:
+			return nil, fmt.Errorf("invalid dns record: %s, must be a or txt", rc.Record)
+		}
+		switch rc.Protocol {
+		case "", "udp":
+		case "tcp":
+			r.TCP = true
+		default:
+			return nil, fmt.Errorf("invalid dns protocol: %s, must be udp or tcp", rc.Protocol)
+		}
+		return r, r.validate()
+	case "stun":
+		r := &STUNResolver{IPv4: rc.IPv4, IPv6: rc.IPv6}
+		return r, r.validate()
+	default:
+		return nil, fmt.Errorf("invalid resolver type: %s", rc.Type)
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DNSResolver queries a DNS server for a "whoami" name, whose record holds the address the query was sent from,
+// such as myip.opendns.com or o-o.myaddr.l.google.com. It works on networks blocking unknown HTTPS endpoints but
+// allowing DNS. The server is queried directly rather than through the system's DNS servers, which would answer
+// with their own address.
+type DNSResolver struct {
+	// Name queried. Its A or AAAA record holds the address, or its TXT record if TXT is set.
+	Name string
+	TXT  bool
+	// IPv4 and IPv6 are the host:port of the DNS server queried over IPv4 and IPv6.
+	// A resolver without a server for a family returns ErrFamilyUnsupported.
+	IPv4 string
+	IPv6 string
+	// TCP queries the server over TCP rather than UDP.
+	TCP bool
+}
+
+// Resolve queries the server of the requested family. The answer must hold an address of that family,
+// otherwise an *UnexpectedResponseError is returned.
+func (r *DNSResolver) Resolve(ctx context.Context, ipv6 bool) (string, error) {
+	server, family := r.IPv4, "4"
+	if ipv6 {
+		server, family = r.IPv6, "6"
+	}
+	if server == "" {
+		return "", ErrFamilyUnsupported
+	}
+
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			// queries go to the server over the requested family, as the answer depends on it.
+			if r.TCP {
+				network = "tcp"
+			}
+			var d net.Dialer
+			return d.DialContext(ctx, network+family, server)
+		},
+	}
+
+	// fully qualified, so the system's search domains are not appended.
+	name := strings.TrimSuffix(r.Name, ".") + "."
+	source := fmt.Sprintf("dns://%s/%s", server, name)
+
+	var answers []string
+	if r.TXT {
+		txt, err := resolver.LookupTXT(ctx, name)
+		if err != nil {
+			// the error names the system's DNS server rather than the one queried.
+			return "", fmt.Errorf("%s: %w", source, err)
+		}
+		answers = txt
+	} else {
+		addrs, err := resolver.LookupNetIP(ctx, "ip"+family, name)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", source, err)
+		}
+		for _, addr := range addrs {
+			answers = append(answers, addr.String())
+		}
+	}
+
+	// TXT records may hold more than the address, e.g. the EDNS client subnet.
+	for _, answer := range answers {
+		if ip, err := parseIP(source, answer, ipv6); err == nil {
+			return ip, nil
+		}
+	}
+	return "", &UnexpectedResponseError{URL: source, Body: strings.Join(answers, " ")}
+}
+
+func (r *DNSResolver) String() string {
+	server := r.IPv4
+	if server == "" {
+		server = r.IPv6
+	}
+	return fmt.Sprintf("dns://%s/%s", server, r.Name)
+}
+
+// validate checks that the resolver has a name and a server for at least one family. Servers without a port
+// are queried on port 53.
+func (r *DNSResolver) validate() error {
+	if r.Name == "" {
+		return errors.New("dns resolver requires a name")
+	}
+	if r.IPv4 == "" && r.IPv6 == "" {
+		return errors.New("dns resolver requires an ipv4 or ipv6 server")
+	}
+	for _, server := range []*string{&r.IPv4, &r.IPv6} {
+		if *server == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(*server); err != nil {
+			*server = net.JoinHostPort(strings.Trim(*server, "[]"), "53")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// whoamiServer starts a DNS server on the loopback address of network, e.g. udp4 or tcp6. Like the servers
+// behind myip.opendns.com and o-o.myaddr.l.google.com it answers every A, AAAA and TXT query with the address
+// the query came from, prefixed by an EDNS client subnet record for TXT queries.
+func whoamiServer(t *testing.T, network string) string {
+	host := "127.0.0.1"
+	if strings.HasSuffix(network, "6") {
+		host = "::1"
+	}
+
+	if strings.HasPrefix(network, "udp") {
+		conn, err := net.ListenPacket(network, net.JoinHostPort(host, "0"))
+		if err != nil {
+			t.Skipf("%s unavailable: %v", network, err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		go func() {
+			buf := make([]byte, 512)
+			for {
+				n, addr, err := conn.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				if msg, err := whoami(buf[:n], addr.(*net.UDPAddr).AddrPort().Addr()); err == nil {
+					conn.WriteTo(msg, addr)
+				}
+			}
+		}()
+		return conn.LocalAddr().String()
+	}
+
+	ln, err := net.Listen(network, net.JoinHostPort(host, "0"))
+	if err != nil {
+		t.Skipf("%s unavailable: %v", network, err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				// messages over TCP are prefixed by their length.
+				var length uint16
+				if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+					return
+				}
+				query := make([]byte, length)
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				msg, err := whoami(query, conn.RemoteAddr().(*net.TCPAddr).AddrPort().Addr())
+				if err != nil {
+					return
+				}
+				conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(msg))))
+				conn.Write(msg)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// whoami answers the query with the client's address.
+func whoami(query []byte, client netip.Addr) ([]byte, error) {
+	client = client.Unmap()
+
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true, RecursionDesired: h.RecursionDesired})
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+
+	rh := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET}
+	switch {
+	case q.Type == dnsmessage.TypeA && client.Is4():
+		err = b.AResource(rh, dnsmessage.AResource{A: client.As4()})
+	case q.Type == dnsmessage.TypeAAAA && client.Is6():
+		err = b.AAAAResource(rh, dnsmessage.AAAAResource{AAAA: client.As16()})
+	case q.Type == dnsmessage.TypeTXT:
+		if err = b.TXTResource(rh, dnsmessage.TXTResource{TXT: []string{"edns0-client-subnet 192.0.2.0/24"}}); err == nil {
+			err = b.TXTResource(rh, dnsmessage.TXTResource{TXT: []string{client.String()}})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+func TestDNSResolver_Resolve(t *testing.T) {
+	tests := []struct {
+		description string
+		network     string
+		txt         bool
+		expect      string
+	}{
+		{description: "A over UDP", network: "udp4", expect: "127.0.0.1"},
+		{description: "AAAA over UDP", network: "udp6", expect: "::1"},
+		{description: "A over TCP", network: "tcp4", expect: "127.0.0.1"},
+		{description: "AAAA over TCP", network: "tcp6", expect: "::1"},
+		{description: "TXT over UDP", network: "udp4", txt: true, expect: "127.0.0.1"},
+		{description: "TXT over TCP", network: "tcp6", txt: true, expect: "::1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			server := whoamiServer(t, tc.network)
+			ipv6 := strings.HasSuffix(tc.network, "6")
+
+			r := &DNSResolver{Name: "myip.example.com", TXT: tc.txt, TCP: strings.HasPrefix(tc.network, "tcp")}
+			if ipv6 {
+				r.IPv6 = server
+			} else {
+				r.IPv4 = server
+			}
+
+			got, err := r.Resolve(context.Background(), ipv6)
+			is.NoErr(err)
+			is.Equal(got, tc.expect)
+		})
+	}
+}
+
+func TestDNSResolver_FamilyUnsupported(t *testing.T) {
+	is := is.New(t)
+	r := &DNSResolver{Name: "myip.example.com", IPv4: whoamiServer(t, "udp4")}
+	_, err := r.Resolve(context.Background(), true)
+	is.True(errors.Is(err, ErrFamilyUnsupported))
+}
+
+func TestDNSResolver_FamilyMismatch(t *testing.T) {
+	is := is.New(t)
+	// queries for the IPv6 address are sent over IPv6, so they can't reach a server listening on IPv4.
+	r := &DNSResolver{Name: "myip.example.com", IPv6: whoamiServer(t, "udp4")}
+	_, err := r.Resolve(context.Background(), true)
+	is.True(err != nil)
+}
+
+func TestResolverConfig_DNS(t *testing.T) {
+	is := is.New(t)
+	file := &File{Resolvers: []ResolverConfig{
+		{Type: "dns", Name: "myip.opendns.com", IPv4: "208.67.222.222", IPv6: "2620:0:ccc::2"},
+		{Type: "dns", Name: "o-o.myaddr.l.google.com", Record: "txt", Protocol: "tcp", IPv4: "216.239.32.10:5353"},
+	}}
+
+	resolvers, err := file.resolvers()
+	is.NoErr(err)
+	is.Equal(resolvers, []Resolver{
+		&DNSResolver{Name: "myip.opendns.com", IPv4: "208.67.222.222:53", IPv6: "[2620:0:ccc::2]:53"},
+		&DNSResolver{Name: "o-o.myaddr.l.google.com", TXT: true, TCP: true, IPv4: "216.239.32.10:5353"},
+	})
+
+	for _, invalid := range []ResolverConfig{
+		{Type: "dns", IPv4: "208.67.222.222"},
+		{Type: "dns", Name: "myip.opendns.com"},
+		{Type: "dns", Name: "myip.opendns.com", IPv4: "208.67.222.222", Record: "mx"},
+		{Type: "dns", Name: "myip.opendns.com", IPv4: "208.67.222.222", Protocol: "quic"},
+	} {
+		_, err := invalid.Resolver()
+		is.True(err != nil)
+	}
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// maxResponseSize bounds how much of a response body is read from an http resolver.
+const maxResponseSize = 1024
+
+// HTTPResolver fetches the public IP from endpoints that respond with the address in plain text,
+// such as icanhazip.com. Dual-stack endpoints answer with the address of whichever family the
+// connection used, so a separate endpoint answering over a single family is used per family.
+type HTTPResolver struct {
+	// IPv4 and IPv6 are the URLs of the endpoints answering with the public IPv4 and IPv6 address.
+	// A resolver without a URL for a family returns ErrFamilyUnsupported.
+	IPv4 string
+	IPv6 string
+	// Client is used to query the endpoints, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Resolve fetches the public IP from the endpoint of the requested family. The response must hold a single
+// address of that family, otherwise an *UnexpectedResponseError is returned.
+func (r *HTTPResolver) Resolve(ctx context.Context, ipv6 bool) (string, error) {
+	endpoint := r.IPv4
+	if ipv6 {
+		endpoint = r.IPv6
+	}
+	if endpoint == "" {
+		return "", ErrFamilyUnsupported
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := r.client().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", &UnexpectedResponseError{URL: endpoint, Body: fmt.Sprintf("%s: %s", res.Status, body)}
+	}
+
+	return parseIP(endpoint, string(body), ipv6)
+}
+
+func (r *HTTPResolver) client() *http.Client {
+	if r.Client == nil {
+		return http.DefaultClient
+	}
+	return r.Client
+}
+
+// proxy returns the proxy the endpoint of the family is queried through, as configured on the client's transport.
+// The default transport reads the proxy from the environment, e.g. HTTPS_PROXY.
+func (r *HTTPResolver) proxy(ipv6 bool) *url.URL {
+	endpoint := r.IPv4
+	if ipv6 {
+		endpoint = r.IPv6
+	}
+	if endpoint == "" {
+		return nil
+	}
+
+	transport := r.client().Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	t, ok := transport.(*http.Transport)
+	if !ok || t.Proxy == nil {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil
+	}
+	proxy, err := t.Proxy(req)
+	if err != nil {
+		return nil
+	}
+	return proxy
+}
+
+func (r *HTTPResolver) String() string {
+	if r.IPv4 != "" {
+		return r.IPv4
+	}
+	return r.IPv6
+}
+
+// validate checks that the resolver has an http or https URL for at least one family.
+func (r *HTTPResolver) validate() error {
+	if r.IPv4 == "" && r.IPv6 == "" {
+		return errors.New("http resolver requires an ipv4 or ipv6 URL")
+	}
+	for _, endpoint := range []string{r.IPv4, r.IPv6} {
+		if endpoint == "" {
+			continue
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return fmt.Errorf("invalid resolver URL: %w", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid resolver URL: %s, must be an http or https URL", endpoint)
+		}
+	}
+	return nil
+}
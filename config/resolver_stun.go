@@ -0,0 +1,248 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// STUN message types and attributes, see RFC 5389.
+const (
+	stunBindingRequest   = 0x0001
+	stunBindingSuccess   = 0x0101
+	stunBindingError     = 0x0111
+	stunMagicCookie      = 0x2112a442
+	stunHeaderSize       = 20
+	stunMappedAddress    = 0x0001
+	stunErrorCode        = 0x0009
+	stunXORMappedAddress = 0x0020
+	stunFamilyIPv4       = 0x01
+	stunFamilyIPv6       = 0x02
+)
+
+var (
+	// stunRTO is how long to wait for a response before retransmitting the request, doubling after every attempt.
+	stunRTO = 500 * time.Millisecond
+	// stunAttempts is the number of times the request is sent.
+	stunAttempts = 4
+)
+
+// errSTUNUnrelated is returned when a datagram is not a response to the request sent, it is ignored.
+var errSTUNUnrelated = errors.New("unrelated STUN message")
+
+// STUNResolver sends a STUN binding request and reads the public IP from the mapped address in the response.
+// It works where HTTP egress is proxied, and reports the address of the actual NAT mapping rather than the
+// address of a proxy.
+type STUNResolver struct {
+	// IPv4 and IPv6 are the host:port of the STUN server queried over IPv4 and IPv6.
+	// A resolver without a server for a family returns ErrFamilyUnsupported.
+	IPv4 string
+	IPv6 string
+}
+
+// Resolve sends a binding request over UDP to the server of the requested family, retransmitting it
+// until a response arrives or ctx is done. The mapped address must be of the requested family,
+// otherwise an *UnexpectedResponseError is returned.
+func (r *STUNResolver) Resolve(ctx context.Context, ipv6 bool) (string, error) {
+	server, network := r.IPv4, "udp4"
+	if ipv6 {
+		server, network = r.IPv6, "udp6"
+	}
+	if server == "" {
+		return "", ErrFamilyUnsupported
+	}
+	source := "stun://" + server
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	// unblock reading once ctx is done, e.g. cancelled by Consensus.
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	req, txID, err := stunRequest()
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 1500)
+	rto := stunRTO
+	for attempt := 0; attempt < stunAttempts; attempt++ {
+		if _, err := conn.Write(req); err != nil {
+			return "", err
+		}
+
+		deadline := time.Now().Add(rto)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		conn.SetReadDeadline(deadline)
+		rto *= 2
+
+		for {
+			n, err := conn.Read(buf)
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break // retransmit
+			}
+			if err != nil {
+				return "", err
+			}
+
+			addr, err := parseSTUNResponse(buf[:n], txID)
+			if errors.Is(err, errSTUNUnrelated) {
+				continue
+			}
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", source, err)
+			}
+			return parseIP(source, addr.String(), ipv6)
+		}
+
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%s: no response after %d attempts", source, stunAttempts)
+}
+
+func (r *STUNResolver) String() string {
+	if r.IPv4 != "" {
+		return "stun://" + r.IPv4
+	}
+	return "stun://" + r.IPv6
+}
+
+// validate checks that the resolver has a server for at least one family. Servers without a port
+// are queried on port 3478.
+func (r *STUNResolver) validate() error {
+	if r.IPv4 == "" && r.IPv6 == "" {
+		return errors.New("stun resolver requires an ipv4 or ipv6 server")
+	}
+	for _, server := range []*string{&r.IPv4, &r.IPv6} {
+		if *server == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(*server); err != nil {
+			*server = net.JoinHostPort(strings.Trim(*server, "[]"), "3478")
+		}
+	}
+	return nil
+}
+
+// stunRequest returns a binding request without attributes along with its random transaction ID.
+func stunRequest() ([]byte, []byte, error) {
+	req := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(req[0:], stunBindingRequest)
+	binary.BigEndian.PutUint16(req[2:], 0) // no attributes
+	binary.BigEndian.PutUint32(req[4:], stunMagicCookie)
+	if _, err := rand.Read(req[8:]); err != nil {
+		return nil, nil, err
+	}
+	return req, req[8:], nil
+}
+
+// parseSTUNResponse returns the mapped address of a binding response to the request with the given transaction ID.
+// The XOR-MAPPED-ADDRESS attribute is preferred, servers implementing RFC 3489 only send a MAPPED-ADDRESS.
+// errSTUNUnrelated is returned if msg is not a response to the request.
+func parseSTUNResponse(msg, txID []byte) (netip.Addr, error) {
+	if len(msg) < stunHeaderSize ||
+		binary.BigEndian.Uint32(msg[4:]) != stunMagicCookie ||
+		!bytes.Equal(msg[8:stunHeaderSize], txID) {
+		return netip.Addr{}, errSTUNUnrelated
+	}
+
+	msgType := binary.BigEndian.Uint16(msg[0:])
+	length := int(binary.BigEndian.Uint16(msg[2:]))
+	if length > len(msg)-stunHeaderSize {
+		return netip.Addr{}, errors.New("truncated STUN message")
+	}
+
+	var mapped, xorMapped netip.Addr
+	var errorCode string
+	for attrs := msg[stunHeaderSize : stunHeaderSize+length]; len(attrs) >= 4; {
+		attrType := binary.BigEndian.Uint16(attrs[0:])
+		attrLen := int(binary.BigEndian.Uint16(attrs[2:]))
+		if attrLen > len(attrs)-4 {
+			return netip.Addr{}, errors.New("truncated STUN attribute")
+		}
+		value := attrs[4 : 4+attrLen]
+
+		switch attrType {
+		case stunMappedAddress:
+			mapped = stunAddress(value, nil)
+		case stunXORMappedAddress:
+			xorMapped = stunAddress(value, msg[4:stunHeaderSize])
+		case stunErrorCode:
+			if len(value) >= 4 {
+				errorCode = fmt.Sprintf("%d %s", int(value[2]&0x7)*100+int(value[3]), value[4:])
+			}
+		}
+
+		// attributes are padded to a multiple of 4 bytes.
+		next := 4 + (attrLen+3)&^3
+		if next > len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+
+	switch msgType {
+	case stunBindingSuccess:
+	case stunBindingError:
+		return netip.Addr{}, fmt.Errorf("binding request failed: %s", errorCode)
+	default:
+		return netip.Addr{}, errSTUNUnrelated
+	}
+
+	if xorMapped.IsValid() {
+		return xorMapped, nil
+	}
+	if mapped.IsValid() {
+		return mapped, nil
+	}
+	return netip.Addr{}, errors.New("binding response holds no mapped address")
+}
+
+// stunAddress decodes a MAPPED-ADDRESS attribute, or a XOR-MAPPED-ADDRESS attribute if key is set.
+// The key is the magic cookie followed by the transaction ID. An invalid address is returned if value is malformed.
+func stunAddress(value, key []byte) netip.Addr {
+	if len(value) < 4 {
+		return netip.Addr{}
+	}
+
+	var ip []byte
+	switch value[1] {
+	case stunFamilyIPv4:
+		ip = bytes.Clone(value[4:min(len(value), 8)])
+		if len(ip) != 4 {
+			return netip.Addr{}
+		}
+	case stunFamilyIPv6:
+		ip = bytes.Clone(value[4:min(len(value), 20)])
+		if len(ip) != 16 {
+			return netip.Addr{}
+		}
+	default:
+		return netip.Addr{}
+	}
+
+	if key != nil {
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+	addr, _ := netip.AddrFromSlice(ip)
+	return addr
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+// stunServer starts a STUN server on the loopback address of network, udp4 or udp6. respond returns the
+// datagrams sent in response to the nth request received from client, starting at 1.
+func stunServer(t *testing.T, network string, respond func(n int, req []byte, client netip.AddrPort) [][]byte) string {
+	host := "127.0.0.1"
+	if strings.HasSuffix(network, "6") {
+		host = "::1"
+	}
+	conn, err := net.ListenPacket(network, net.JoinHostPort(host, "0"))
+	if err != nil {
+		t.Skipf("%s unavailable: %v", network, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var requests atomic.Int32
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			for _, msg := range respond(int(requests.Add(1)), buf[:n], addr.(*net.UDPAddr).AddrPort()) {
+				conn.WriteTo(msg, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// stunMessage encodes a STUN message of the given type in response to req.
+func stunMessage(msgType uint16, req []byte, attrs ...[]byte) []byte {
+	msg := binary.BigEndian.AppendUint16(nil, msgType)
+	length := 0
+	for _, attr := range attrs {
+		length += len(attr)
+	}
+	msg = binary.BigEndian.AppendUint16(msg, uint16(length))
+	msg = append(msg, req[4:20]...) // magic cookie and transaction ID
+	for _, attr := range attrs {
+		msg = append(msg, attr...)
+	}
+	return msg
+}
+
+// stunAttr encodes an attribute, padding its value to a multiple of 4 bytes.
+func stunAttr(attrType uint16, value []byte) []byte {
+	attr := binary.BigEndian.AppendUint16(nil, attrType)
+	attr = binary.BigEndian.AppendUint16(attr, uint16(len(value)))
+	attr = append(attr, value...)
+	for len(attr)%4 != 0 {
+		attr = append(attr, 0)
+	}
+	return attr
+}
+
+// mappedAddress encodes a MAPPED-ADDRESS attribute, or a XOR-MAPPED-ADDRESS attribute if req is set.
+func mappedAddress(addr netip.AddrPort, req []byte) []byte {
+	family, ip := byte(0x01), addr.Addr().Unmap().AsSlice()
+	if len(ip) == 16 {
+		family = 0x02
+	}
+	port := addr.Port()
+	if req == nil {
+		value := append([]byte{0, family}, binary.BigEndian.AppendUint16(nil, port)...)
+		return stunAttr(0x0001, append(value, ip...))
+	}
+
+	key := req[4:20]
+	port ^= binary.BigEndian.Uint16(key)
+	for i := range ip {
+		ip[i] ^= key[i]
+	}
+	value := append([]byte{0, family}, binary.BigEndian.AppendUint16(nil, port)...)
+	return stunAttr(0x0020, append(value, ip...))
+}
+
+func TestSTUNResolver_Resolve(t *testing.T) {
+	stunRTO = 10 * time.Millisecond
+	t.Cleanup(func() { stunRTO = 500 * time.Millisecond })
+
+	other := netip.MustParseAddrPort("192.0.2.1:4242")
+
+	tests := []struct {
+		description string
+		network     string
+		respond     func(n int, req []byte, client netip.AddrPort) [][]byte
+		expect      string
+		expectErr   bool
+	}{
+		{
+			description: "IPv4",
+			network:     "udp4",
+			respond: func(n int, req []byte, client netip.AddrPort) [][]byte {
+				return [][]byte{stunMessage(0x0101, req, mappedAddress(client, req))}
+			},
+			expect: "127.0.0.1",
+		},
+		{
+			description: "IPv6",
+			network:     "udp6",
+			respond: func(n int, req []byte, client netip.AddrPort) [][]byte {
+				return [][]byte{stunMessage(0x0101, req, mappedAddress(client, req))}
+			},
+			expect: "::1",
+		},
+		{
+			description: "RFC 3489 server",
+			network:     "udp4",
+			respond: func(n int, req []byte, client netip.AddrPort) [][]byte {
+				return [][]byte{stunMessage(0x0101, req, mappedAddress(other, nil))}
+			},
+			expect: "192.0.2.1",
+		},
+		{
+			description: "XOR-MAPPED-ADDRESS is preferred",
+			network:     "udp4",
+			respond: func(n int, req []byte, client netip.AddrPort) [][]byte {
+				return [][]byte{stunMessage(0x0101, req, mappedAddress(other, nil), stunAttr(0x8022, []byte("fwsync")), mappedAddress(client, req))}
+			},
+			expect: "127.0.0.1",
+		},
+		{
+			description: "unrelated responses are ignored",
+			network:     "udp4",
+			respond: func(n int, req []byte, client netip.AddrPort) [][]byte {
+				unrelated := append([]byte{}, req...)
+				unrelated[19] ^= 0xff // different transaction ID
+				return [][]byte{
+					stunMessage(0x0101, unrelated, mappedAddress(other, unrelated)),
+					[]byte("not stun"),
+					stunMessage(0x0101, req, mappedAddress(client, req)),
+				}
+			},
+			expect: "127.0.0.1",
+		},
+		{
+			description: "request is retransmitted",
+			network:     "udp4",
+			respond: func(n int, req []byte, client netip.AddrPort) [][]byte {
+				if n < 3 {
+					return nil // dropped
+				}
+				return [][]byte{stunMessage(0x0101, req, mappedAddress(client, req))}
+			},
+			expect: "127.0.0.1",
+		},
+		{
+			description: "no response",
+			network:     "udp4",
+			respond: func(n int, req []byte, client netip.AddrPort) [][]byte {
+				return nil
+			},
+			expectErr: true,
+		},
+		{
+			description: "error response",
+			network:     "udp4",
+			respond: func(n int, req []byte, client netip.AddrPort) [][]byte {
+				return [][]byte{stunMessage(0x0111, req, stunAttr(0x0009, append([]byte{0, 0, 4, 20}, "Unknown Attribute"...)))}
+			},
+			expectErr: true,
+		},
+		{
+			description: "no mapped address",
+			network:     "udp4",
+			respond: func(n int, req []byte, client netip.AddrPort) [][]byte {
+				return [][]byte{stunMessage(0x0101, req)}
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			server := stunServer(t, tc.network, tc.respond)
+			ipv6 := strings.HasSuffix(tc.network, "6")
+
+			r := &STUNResolver{IPv4: server}
+			if ipv6 {
+				r = &STUNResolver{IPv6: server}
+			}
+
+			got, err := r.Resolve(context.Background(), ipv6)
+			if tc.expectErr {
+				is.True(err != nil)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(got, tc.expect)
+		})
+	}
+}
+
+func TestSTUNResolver_FamilyMismatch(t *testing.T) {
+	is := is.New(t)
+	server := stunServer(t, "udp4", func(n int, req []byte, client netip.AddrPort) [][]byte {
+		return [][]byte{stunMessage(0x0101, req, mappedAddress(netip.MustParseAddrPort("[2001:db8::1]:4242"), req))}
+	})
+
+	_, err := (&STUNResolver{IPv4: server}).Resolve(context.Background(), false)
+	var respErr *UnexpectedResponseError
+	is.True(errors.As(err, &respErr))
+}
+
+func TestSTUNResolver_Cancel(t *testing.T) {
+	is := is.New(t)
+	server := stunServer(t, "udp4", func(n int, req []byte, client netip.AddrPort) [][]byte {
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := (&STUNResolver{IPv4: server}).Resolve(ctx, false)
+	is.True(errors.Is(err, context.Canceled))
+	is.True(time.Since(start) < stunRTO) // not waiting for the retransmission timeout
+}
+
+func TestResolverConfig_STUN(t *testing.T) {
+	is := is.New(t)
+	r, err := ResolverConfig{Type: "stun", IPv4: "stun.example.com", IPv6: "2001:db8::1"}.Resolver()
+	is.NoErr(err)
+	is.Equal(r, &STUNResolver{IPv4: "stun.example.com:3478", IPv6: "[2001:db8::1]:3478"})
+
+	_, err = ResolverConfig{Type: "stun"}.Resolver()
+	is.True(err != nil)
+}
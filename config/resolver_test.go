@@ -0,0 +1,271 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+// ipServer starts a server responding with body, or with an error status if body is empty.
+func ipServer(t *testing.T, body string) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body == "" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestHTTPResolver_Resolve(t *testing.T) {
+	tests := []struct {
+		description string
+		resolver    func(t *testing.T) *HTTPResolver
+		ipv6        bool
+		expect      string
+		expectErr   bool
+	}{
+		{
+			description: "IPv4",
+			resolver: func(t *testing.T) *HTTPResolver {
+				return &HTTPResolver{IPv4: ipServer(t, "1.1.1.1"), IPv6: ipServer(t, "2001:db8::1")}
+			},
+			expect: "1.1.1.1",
+		},
+		{
+			description: "IPv6",
+			resolver: func(t *testing.T) *HTTPResolver {
+				return &HTTPResolver{IPv4: ipServer(t, "1.1.1.1"), IPv6: ipServer(t, "2001:db8::1")}
+			},
+			ipv6:   true,
+			expect: "2001:db8::1",
+		},
+		{
+			description: "captive portal",
+			resolver: func(t *testing.T) *HTTPResolver {
+				return &HTTPResolver{IPv4: ipServer(t, "<html>captive portal</html>")}
+			},
+			expectErr: true,
+		},
+		{
+			description: "error status",
+			resolver: func(t *testing.T) *HTTPResolver {
+				return &HTTPResolver{IPv4: ipServer(t, "")}
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			got, err := tc.resolver(t).Resolve(context.Background(), tc.ipv6)
+			if tc.expectErr {
+				var respErr *UnexpectedResponseError
+				is.True(errors.As(err, &respErr))
+				return
+			}
+			is.NoErr(err)
+			is.Equal(got, tc.expect)
+		})
+	}
+}
+
+func TestHTTPResolver_FamilyUnsupported(t *testing.T) {
+	is := is.New(t)
+	_, err := (&HTTPResolver{IPv4: ipServer(t, "1.1.1.1")}).Resolve(context.Background(), true)
+	is.True(errors.Is(err, ErrFamilyUnsupported))
+}
+
+func TestConsensus(t *testing.T) {
+	tests := []struct {
+		description string
+		// answers of each resolver, an empty answer fails.
+		answers   []string
+		expect    string
+		expectErr bool
+	}{
+		{
+			description: "all agree",
+			answers:     []string{"1.1.1.1", "1.1.1.1", "1.1.1.1"},
+			expect:      "1.1.1.1",
+		},
+		{
+			description: "hijacked resolver is outvoted",
+			answers:     []string{"1.1.1.1", "6.6.6.6", "1.1.1.1"},
+			expect:      "1.1.1.1",
+		},
+		{
+			description: "failed resolvers are ignored",
+			answers:     []string{"", "1.1.1.1", "", "1.1.1.1"},
+			expect:      "1.1.1.1",
+		},
+		{
+			description: "single resolver",
+			answers:     []string{"1.1.1.1"},
+			expect:      "1.1.1.1",
+		},
+		{
+			description: "single answer",
+			answers:     []string{"", "1.1.1.1", ""},
+			expectErr:   true,
+		},
+		{
+			description: "no majority",
+			answers:     []string{"1.1.1.1", "6.6.6.6", ""},
+			expectErr:   true,
+		},
+		{
+			description: "every resolver fails",
+			answers:     []string{"", ""},
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			resolvers := make([]Resolver, 0, len(tc.answers))
+			for _, answer := range tc.answers {
+				resolvers = append(resolvers, &HTTPResolver{IPv4: ipServer(t, answer)})
+			}
+
+			got, err := Consensus(context.Background(), resolvers, false)
+			if tc.expectErr {
+				is.True(err != nil)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(got, tc.expect)
+		})
+	}
+}
+
+func TestConsensus_NoConsensusError(t *testing.T) {
+	is := is.New(t)
+	honest := &HTTPResolver{IPv4: ipServer(t, "1.1.1.1")}
+	hijacked := &HTTPResolver{IPv4: ipServer(t, "6.6.6.6")}
+
+	_, err := Consensus(context.Background(), []Resolver{honest, hijacked}, false)
+	var consensusErr *NoConsensusError
+	is.True(errors.As(err, &consensusErr))
+	is.Equal(consensusErr.Answers, map[string][]string{
+		"1.1.1.1": {honest.IPv4},
+		"6.6.6.6": {hijacked.IPv4},
+	})
+}
+
+func TestConsensus_SingleAnswerError(t *testing.T) {
+	is := is.New(t)
+	failed := &HTTPResolver{IPv4: ipServer(t, "")}
+	hijacked := &HTTPResolver{IPv4: ipServer(t, "6.6.6.6")}
+
+	_, err := Consensus(context.Background(), []Resolver{failed, hijacked}, false)
+	var singleErr *SingleAnswerError
+	is.True(errors.As(err, &singleErr))
+	is.Equal(singleErr.IP, "6.6.6.6")
+	is.Equal(singleErr.Resolver, hijacked.IPv4)
+
+	var respErr *UnexpectedResponseError
+	is.True(errors.As(err, &respErr)) // why the other resolver failed
+}
+
+func TestConsensus_FamilyUnsupported(t *testing.T) {
+	is := is.New(t)
+	resolvers := []Resolver{
+		&HTTPResolver{IPv4: ipServer(t, "1.1.1.1"), IPv6: ipServer(t, "2001:db8::1")},
+		&HTTPResolver{IPv4: ipServer(t, "1.1.1.1")}, // IPv4 only, doesn't count against the IPv6 answer
+	}
+
+	got, err := Consensus(context.Background(), resolvers, true)
+	is.NoErr(err)
+	is.Equal(got, "2001:db8::1")
+}
+
+func TestFile_PublicIPs(t *testing.T) {
+	is := is.New(t)
+	file := &File{Resolvers: []ResolverConfig{
+		{IPv4: ipServer(t, "1.1.1.1"), IPv6: ipServer(t, "2001:db8::1")},
+		{Type: "http", IPv4: ipServer(t, "1.1.1.1")},
+	}}
+
+	ips, err := file.PublicIPs()
+	is.NoErr(err)
+	is.Equal(ips, []string{"1.1.1.1", "2001:db8::1"})
+}
+
+// rendezvousResolver only answers for IPv4 once it is queried for IPv6, which requires both to be queried at once.
+type rendezvousResolver struct {
+	ipv6Queried chan struct{}
+}
+
+func (r *rendezvousResolver) Resolve(ctx context.Context, ipv6 bool) (string, error) {
+	if ipv6 {
+		close(r.ipv6Queried)
+		return "2001:db8::1", nil
+	}
+	select {
+	case <-r.ipv6Queried:
+		return "1.1.1.1", nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (r *rendezvousResolver) String() string {
+	return "rendezvous"
+}
+
+func TestDetectPublicIPs_Concurrent(t *testing.T) {
+	is := is.New(t)
+	detections, err := DetectPublicIPs(&rendezvousResolver{ipv6Queried: make(chan struct{})})
+	is.NoErr(err)
+	is.Equal(len(detections), 2)
+	is.Equal(detections[0].IP, "1.1.1.1")
+	is.Equal(detections[1].IP, "2001:db8::1")
+}
+
+func TestLoadFile_Resolvers(t *testing.T) {
+	tests := []struct {
+		description string
+		resolvers   string
+		expectErr   bool
+	}{
+		{
+			description: "http resolver",
+			resolvers:   "  - ipv4: https://ipv4.example.com\n    ipv6: https://ipv6.example.com\n",
+		},
+		{
+			description: "unknown type",
+			resolvers:   "  - type: carrier-pigeon\n    ipv4: https://ipv4.example.com\n",
+			expectErr:   true,
+		},
+		{
+			description: "no URL",
+			resolvers:   "  - type: http\n",
+			expectErr:   true,
+		},
+		{
+			description: "invalid URL",
+			resolvers:   "  - ipv4: ipv4.example.com\n",
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			in := "profiles:\n  dev:\n    name: dev-vm\nresolvers:\n" + tc.resolvers
+			_, err := LoadFile(bytes.NewBufferString(in))
+			is.Equal(err != nil, tc.expectErr)
+		})
+	}
+}
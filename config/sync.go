@@ -0,0 +1,65 @@
+package config
+
+import "github.com/jharshman/fwsync/internal/providers/generic"
+
+// Refresh records the IPs held by the configuration as seen, prunes the expired IPs and then adds the missing IPs
+// with AddCurrent. Pruning first frees up room for the new IPs. A non-empty label or note is set on every IP.
+// It reports whether any IP was added and returns the pruned IPs.
+func (c *Config) Refresh(ips []string, label, note string) (bool, []string, error) {
+	for _, ip := range ips {
+		c.Seen(ip)
+	}
+	pruned := c.Prune()
+
+	added, err := c.AddCurrent(ips)
+	if err != nil {
+		return false, nil, err
+	}
+	for _, ip := range ips {
+		entry := c.Entry(ip)
+		if label != "" {
+			entry.Label = label
+		}
+		if note != "" {
+			entry.Note = note
+		}
+	}
+	return added, pruned, nil
+}
+
+// Desired returns the ranges a firewall currently allowing current should allow after a sync.
+// With overwrite these are exactly the source IPs, otherwise ranges fwsync does not own are kept.
+func (c *Config) Desired(current []string, overwrite bool) []string {
+	if overwrite {
+		return c.IPs()
+	}
+	return generic.Merge(current, c.Owned(), c.IPs())
+}
+
+// Unexpected returns the unchanged ranges on the firewall that fwsync doesn't own and that were not on
+// the firewall after last, the last change fwsync applied to it. They were added outside of fwsync.
+func (c *Config) Unexpected(changes generic.Changes, last Change) []string {
+	applied := make(map[string]bool, len(last.Current))
+	for _, r := range generic.FromWire(last.Current) {
+		applied[r] = true
+	}
+
+	var unexpected []string
+	for _, r := range changes.Unchanged {
+		if _, ok := c.HasIP(r); !ok && !applied[r] {
+			unexpected = append(unexpected, r)
+		}
+	}
+	return unexpected
+}
+
+// Last returns the most recent change applied to the firewall of the profile, or false if none was recorded.
+func (h *History) Last(c *Config) (Change, bool) {
+	for i := len(h.Changes) - 1; i >= 0; i-- {
+		change := h.Changes[i]
+		if change.Profile == c.Profile && change.Provider == c.Provider && change.Firewall == c.Name {
+			return change, true
+		}
+	}
+	return Change{}, false
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jharshman/fwsync/internal/providers/generic"
+	"github.com/matryer/is"
+)
+
+func TestConfig_Refresh(t *testing.T) {
+	is := is.New(t)
+	cfg := &Config{IPLimit: 3, SourceIPs: []Entry{
+		{IP: "1.1.1.1/32", LastSeenAt: testTime.Add(-time.Hour)},
+		{IP: "3.3.3.3/32", ExpiresAt: testTime.Add(-time.Minute)},
+	}}
+
+	added, pruned, err := cfg.Refresh([]string{"1.1.1.1", "2.2.2.2"}, "home", "")
+	is.NoErr(err)
+	is.True(added)
+	is.Equal(pruned, []string{"3.3.3.3/32"})
+	is.Equal(cfg.SourceIPs, []Entry{
+		{IP: "1.1.1.1/32", Label: "home", LastSeenAt: testTime},
+		{IP: "2.2.2.2/32", Label: "home", AddedAt: testTime, LastSeenAt: testTime},
+	})
+
+	added, pruned, err = cfg.Refresh([]string{"1.1.1.1", "2.2.2.2"}, "", "")
+	is.NoErr(err)
+	is.True(!added)
+	is.Equal(len(pruned), 0)
+}
+
+func TestConfig_Desired(t *testing.T) {
+	tests := []struct {
+		description string
+		config      *Config
+		current     []string
+		overwrite   bool
+		expect      []string
+	}{
+		{
+			description: "owned ranges are replaced",
+			config:      &Config{SourceIPs: entries("2.2.2.2/32"), Managed: []string{"1.1.1.1/32"}},
+			current:     []string{"1.1.1.1/32"},
+			expect:      []string{"2.2.2.2/32"},
+		},
+		{
+			description: "foreign ranges are kept",
+			config:      &Config{SourceIPs: entries("2.2.2.2/32"), Managed: []string{"1.1.1.1/32"}},
+			current:     []string{"1.1.1.1", "10.0.0.0/8"},
+			expect:      []string{"10.0.0.0/8", "2.2.2.2/32"},
+		},
+		{
+			description: "legacy configs own their source IPs only",
+			config:      &Config{SourceIPs: entries("1.1.1.1/32", "2.2.2.2/32")},
+			current:     []string{"1.1.1.1/32", "10.0.0.0/8"},
+			expect:      []string{"1.1.1.1/32", "10.0.0.0/8", "2.2.2.2/32"},
+		},
+		{
+			description: "no longer managed",
+			config:      &Config{SourceIPs: entries("2.2.2.2/32"), Managed: []string{}},
+			current:     []string{"1.1.1.1/32"},
+			expect:      []string{"1.1.1.1/32", "2.2.2.2/32"},
+		},
+		{
+			description: "overwrite drops foreign ranges",
+			config:      &Config{SourceIPs: entries("2.2.2.2/32"), Managed: []string{"1.1.1.1/32"}},
+			current:     []string{"1.1.1.1/32", "10.0.0.0/8"},
+			overwrite:   true,
+			expect:      []string{"2.2.2.2/32"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(tc.config.Desired(tc.current, tc.overwrite), tc.expect)
+		})
+	}
+}
+
+func TestConfig_Unexpected(t *testing.T) {
+	tests := []struct {
+		description string
+		config      *Config
+		current     []string
+		last        Change
+		expect      []string
+	}{
+		{
+			description: "owned ranges are expected",
+			config:      &Config{SourceIPs: entries("1.1.1.1/32"), Managed: []string{"1.1.1.1/32"}},
+			current:     []string{"1.1.1.1/32"},
+			last:        Change{Current: []string{"1.1.1.1/32"}},
+		},
+		{
+			description: "foreign ranges present at the last sync are expected",
+			config:      &Config{SourceIPs: entries("1.1.1.1/32"), Managed: []string{"1.1.1.1/32"}},
+			current:     []string{"1.1.1.1/32", "10.0.0.0/8"},
+			last:        Change{Current: []string{"1.1.1.1/32", "10.0.0.0/8"}},
+		},
+		{
+			description: "foreign ranges added since the last sync",
+			config:      &Config{SourceIPs: entries("1.1.1.1/32"), Managed: []string{"1.1.1.1/32"}},
+			current:     []string{"1.1.1.1/32", "10.0.0.0/8", "0.0.0.0/0"},
+			last:        Change{Current: []string{"1.1.1.1/32", "10.0.0.0/8"}},
+			expect:      []string{"0.0.0.0/0"},
+		},
+		{
+			description: "ranges recorded in wire format",
+			config:      &Config{SourceIPs: entries("1.1.1.1/32")},
+			current:     []string{"1.1.1.1/32", "3.3.3.3"},
+			last:        Change{Current: []string{"1.1.1.1", "3.3.3.3"}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			changes := generic.Diff(tc.current, tc.config.Desired(tc.current, false))
+			is.Equal(tc.config.Unexpected(changes, tc.last), tc.expect)
+		})
+	}
+}
+
+func TestHistory_Last(t *testing.T) {
+	is := is.New(t)
+	cfg := &Config{Profile: "work", Provider: "google", Name: "dev-vm"}
+	history := &History{Changes: []Change{
+		{Profile: "work", Provider: "google", Firewall: "dev-vm", Current: []string{"1.1.1.1/32"}},
+		{Profile: "work", Provider: "google", Firewall: "dev-vm", Current: []string{"2.2.2.2/32"}},
+		{Profile: "work", Provider: "google", Firewall: "old-vm", Current: []string{"3.3.3.3/32"}},
+		{Profile: "home", Provider: "google", Firewall: "dev-vm", Current: []string{"4.4.4.4/32"}},
+	}}
+
+	last, ok := history.Last(cfg)
+	is.True(ok)
+	is.Equal(last.Current, []string{"2.2.2.2/32"})
+
+	_, ok = history.Last(&Config{Profile: "work", Provider: "aws", Name: "dev-vm"})
+	is.True(!ok)
+}
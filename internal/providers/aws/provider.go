@@ -0,0 +1,311 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/jharshman/fwsync/internal/providers/generic"
+)
+
+// Client is an implementation of generic.Provider for Amazon EC2 Security Groups.
+// A Security Group plays the role of the firewall and fwsync manages the source ranges of
+// one of its inbound rules, or of every inbound rule allowing address ranges when no rule is
+// configured. Rules only referencing security groups or prefix lists are never managed.
+// Ports and protocols are left untouched.
+type Client struct {
+	conn *ec2.Client
+	rule string
+}
+
+// New returns a new Client for the given region. If region is empty, the region
+// is taken from the standard AWS environment variables and shared configuration.
+// The rule names the inbound rule managed by fwsync by its protocol and ports, e.g. tcp/22.
+func New(region, rule string) (*Client, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("no region configured: set --region or AWS_REGION")
+	}
+
+	return &Client{conn: ec2.NewFromConfig(cfg), rule: rule}, nil
+}
+
+// List returns all the Security Groups in the region along with the names of their inbound
+// rules allowing address ranges.
+func (c *Client) List(ctx context.Context) ([]generic.Firewall, error) {
+	groups, err := c.describe(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	fws := make([]generic.Firewall, 0, len(groups))
+	for _, sg := range groups {
+		rules := make([]string, 0, len(sg.IpPermissions))
+		for _, perm := range sg.IpPermissions {
+			if hasRanges(perm) {
+				rules = append(rules, ruleName(perm))
+			}
+		}
+
+		perms, _ := c.managedRules(sg)
+		fw := toFirewall(sg, perms)
+		fw.Rules = rules
+		fws = append(fws, fw)
+	}
+
+	return fws, nil
+}
+
+// Get searches for a Security Group by name and returns it as a *generic.Firewall holding the
+// source ranges of the managed inbound rules.
+func (c *Client) Get(ctx context.Context, name string) (*generic.Firewall, error) {
+	sg, err := c.group(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	perms, err := c.managedRules(*sg)
+	if err != nil {
+		return nil, fmt.Errorf("security group: %s: %w", name, err)
+	}
+
+	fw := toFirewall(*sg, perms)
+	return &fw, nil
+}
+
+// Update replaces the source ranges allowed across the managed inbound rules with sourceRanges, see generic.RuleRanges.
+// New ranges are authorized before stale ones are revoked so access is never interrupted.
+func (c *Client) Update(ctx context.Context, name string, sourceRanges []string) error {
+	sg, err := c.group(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	perms, err := c.managedRules(*sg)
+	if err != nil {
+		return fmt.Errorf("security group: %s: %w", name, err)
+	}
+
+	fw := toFirewall(*sg, perms)
+	previous := append(fw.AllowedIPv4Addresses, fw.AllowedIPv6Addresses...)
+
+	// every rule is checked before any is written.
+	authorize := make([]types.IpPermission, len(perms))
+	revoke := make([]types.IpPermission, len(perms))
+	for i, perm := range perms {
+		ranges := generic.RuleRanges(permRanges(perm), previous, sourceRanges)
+		if len(ranges) == 0 && len(perm.UserIdGroupPairs)+len(perm.PrefixListIds) == 0 {
+			// EC2 deletes a rule once its last source is revoked.
+			return fmt.Errorf("security group: %s: rule %s would be left without sources", name, ruleName(perm))
+		}
+		ipv4, ipv6 := generic.SplitByFamily(ranges)
+
+		current4 := make([]string, 0, len(perm.IpRanges))
+		for _, r := range perm.IpRanges {
+			current4 = append(current4, aws.ToString(r.CidrIp))
+		}
+		add4, remove4 := diff(current4, ipv4)
+		for _, cidr := range add4 {
+			authorize[i].IpRanges = append(authorize[i].IpRanges, types.IpRange{CidrIp: aws.String(cidr)})
+		}
+		for _, cidr := range remove4 {
+			revoke[i].IpRanges = append(revoke[i].IpRanges, types.IpRange{CidrIp: aws.String(cidr)})
+		}
+
+		current6 := make([]string, 0, len(perm.Ipv6Ranges))
+		for _, r := range perm.Ipv6Ranges {
+			current6 = append(current6, aws.ToString(r.CidrIpv6))
+		}
+		add6, remove6 := diff(current6, ipv6)
+		for _, cidr := range add6 {
+			authorize[i].Ipv6Ranges = append(authorize[i].Ipv6Ranges, types.Ipv6Range{CidrIpv6: aws.String(cidr)})
+		}
+		for _, cidr := range remove6 {
+			revoke[i].Ipv6Ranges = append(revoke[i].Ipv6Ranges, types.Ipv6Range{CidrIpv6: aws.String(cidr)})
+		}
+	}
+
+	for i, perm := range perms {
+		if len(authorize[i].IpRanges)+len(authorize[i].Ipv6Ranges) > 0 {
+			_, err = c.conn.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+				GroupId:       sg.GroupId,
+				IpPermissions: []types.IpPermission{withPorts(perm, authorize[i])},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(revoke[i].IpRanges)+len(revoke[i].Ipv6Ranges) > 0 {
+			_, err = c.conn.RevokeSecurityGroupIngress(ctx, &ec2.RevokeSecurityGroupIngressInput{
+				GroupId:       sg.GroupId,
+				IpPermissions: []types.IpPermission{withPorts(perm, revoke[i])},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// AddressFormat reports that EC2 requires source ranges in CIDR notation.
+func (c *Client) AddressFormat() generic.AddressFormat {
+	return generic.FormatCIDR
+}
+
+// managedRules returns the inbound rule named by c.rule or, when no rule is configured, every inbound
+// rule allowing address ranges. Rules only referencing security groups or prefix lists are skipped:
+// adding address ranges to them would open their ports, e.g. every port of the default group's
+// self-referencing rule, to those addresses.
+func (c *Client) managedRules(sg types.SecurityGroup) ([]types.IpPermission, error) {
+	var perms []types.IpPermission
+	for _, perm := range sg.IpPermissions {
+		if !hasRanges(perm) {
+			continue
+		}
+		if c.rule != "" && ruleName(perm) != c.rule {
+			continue
+		}
+		perms = append(perms, perm)
+	}
+
+	if len(perms) > 0 {
+		return perms, nil
+	}
+	if c.rule != "" {
+		return nil, fmt.Errorf("no inbound rule %s allowing address ranges", c.rule)
+	}
+	return nil, fmt.Errorf("no inbound rules allowing address ranges")
+}
+
+// hasRanges reports whether an inbound rule allows any IPv4 or IPv6 address range.
+func hasRanges(perm types.IpPermission) bool {
+	return len(perm.IpRanges)+len(perm.Ipv6Ranges) > 0
+}
+
+// ruleName identifies an inbound rule by its protocol and port range, e.g. tcp/22, tcp/8000-8080 or all.
+func ruleName(perm types.IpPermission) string {
+	protocol := aws.ToString(perm.IpProtocol)
+	if protocol == "-1" {
+		return "all"
+	}
+
+	from, to := aws.ToInt32(perm.FromPort), aws.ToInt32(perm.ToPort)
+	if from == to {
+		return fmt.Sprintf("%s/%d", protocol, from)
+	}
+	return fmt.Sprintf("%s/%d-%d", protocol, from, to)
+}
+
+// group looks up a single Security Group by its name.
+func (c *Client) group(ctx context.Context, name string) (*types.SecurityGroup, error) {
+	groups, err := c.describe(ctx, []types.Filter{{Name: aws.String("group-name"), Values: []string{name}}})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("no security group found matching filter: group-name:%s", name)
+	}
+
+	if len(groups) > 1 {
+		return nil, fmt.Errorf("more than one security group matching filter: group-name:%s", name)
+	}
+
+	return &groups[0], nil
+}
+
+func (c *Client) describe(ctx context.Context, filters []types.Filter) ([]types.SecurityGroup, error) {
+	var groups []types.SecurityGroup
+	pages := ec2.NewDescribeSecurityGroupsPaginator(c.conn, &ec2.DescribeSecurityGroupsInput{Filters: filters})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, page.SecurityGroups...)
+	}
+	return groups, nil
+}
+
+// withPorts copies the protocol and port range of perm onto ranges.
+func withPorts(perm types.IpPermission, ranges types.IpPermission) types.IpPermission {
+	ranges.IpProtocol = perm.IpProtocol
+	ranges.FromPort = perm.FromPort
+	ranges.ToPort = perm.ToPort
+	return ranges
+}
+
+// diff returns the ranges in desired missing from current and the ranges in current missing from desired.
+// Ranges are compared in canonical CIDR form, the ranges to remove are returned as written in current.
+func diff(current, desired []string) (add []string, remove []string) {
+	have := make(map[string]bool, len(current))
+	for _, r := range generic.FromWire(current) {
+		have[r] = true
+	}
+
+	want := make(map[string]bool, len(desired))
+	for _, r := range generic.FromWire(desired) {
+		want[r] = true
+		if !have[r] {
+			add = append(add, r)
+		}
+	}
+
+	for i, r := range generic.FromWire(current) {
+		if !want[r] {
+			remove = append(remove, current[i])
+		}
+	}
+	return add, remove
+}
+
+// permRanges returns the IPv4 and IPv6 ranges allowed by an inbound rule.
+func permRanges(perm types.IpPermission) []string {
+	ranges := make([]string, 0, len(perm.IpRanges)+len(perm.Ipv6Ranges))
+	for _, r := range perm.IpRanges {
+		ranges = append(ranges, aws.ToString(r.CidrIp))
+	}
+	for _, r := range perm.Ipv6Ranges {
+		ranges = append(ranges, aws.ToString(r.CidrIpv6))
+	}
+	return ranges
+}
+
+// toFirewall collects the unique source ranges across the given inbound rules of the Security Group.
+func toFirewall(sg types.SecurityGroup, perms []types.IpPermission) generic.Firewall {
+	seen := make(map[string]bool)
+	ipv4, ipv6 := []string{}, []string{}
+	for _, perm := range perms {
+		for _, r := range perm.IpRanges {
+			cidr := aws.ToString(r.CidrIp)
+			if !seen[cidr] {
+				seen[cidr] = true
+				ipv4 = append(ipv4, cidr)
+			}
+		}
+		for _, r := range perm.Ipv6Ranges {
+			cidr := aws.ToString(r.CidrIpv6)
+			if !seen[cidr] {
+				seen[cidr] = true
+				ipv6 = append(ipv6, cidr)
+			}
+		}
+	}
+
+	return generic.Firewall{
+		Name:                 aws.ToString(sg.GroupName),
+		AllowedIPv4Addresses: ipv4,
+		AllowedIPv6Addresses: ipv6,
+		Misc:                 map[string]any{"id": aws.ToString(sg.GroupId)},
+	}
+}
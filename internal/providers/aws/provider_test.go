@@ -0,0 +1,337 @@
+package aws
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/jharshman/fwsync/internal/providers/generic"
+	"github.com/matryer/is"
+)
+
+// fakeRule is the in-memory representation of a Security Group inbound rule held by fakeEC2.
+type fakeRule struct {
+	Protocol string
+	FromPort int
+	ToPort   int
+	Ranges   []string
+	// IDs of the security groups allowed by the rule.
+	Groups []string
+}
+
+type fakeRange struct {
+	CidrIP string `xml:"cidrIp"`
+}
+
+type fakeGroupPair struct {
+	GroupID string `xml:"groupId"`
+}
+
+// MarshalXML nests each range in its own item element as the EC2 Query API does.
+func (r fakeRule) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	out := struct {
+		Protocol string          `xml:"ipProtocol"`
+		FromPort int             `xml:"fromPort"`
+		ToPort   int             `xml:"toPort"`
+		Ranges   []fakeRange     `xml:"ipRanges>item"`
+		Groups   []fakeGroupPair `xml:"groups>item"`
+	}{Protocol: r.Protocol, FromPort: r.FromPort, ToPort: r.ToPort}
+	for _, cidr := range r.Ranges {
+		out.Ranges = append(out.Ranges, fakeRange{CidrIP: cidr})
+	}
+	for _, id := range r.Groups {
+		out.Groups = append(out.Groups, fakeGroupPair{GroupID: id})
+	}
+	return e.EncodeElement(out, start)
+}
+
+type fakeGroup struct {
+	ID    string     `xml:"groupId"`
+	Name  string     `xml:"groupName"`
+	Rules []fakeRule `xml:"ipPermissions>item"`
+}
+
+// fakeEC2 is a minimal stand-in for the EC2 Query API supporting the Security Group calls used by Client.
+type fakeEC2 struct {
+	mu     sync.Mutex
+	groups []*fakeGroup
+	calls  []string
+}
+
+func (f *fakeEC2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	action := r.Form.Get("Action")
+	f.calls = append(f.calls, action)
+
+	switch action {
+	case "DescribeSecurityGroups":
+		var groups []*fakeGroup
+		for _, g := range f.groups {
+			if name := r.Form.Get("Filter.1.Value.1"); name != "" && g.Name != name {
+				continue
+			}
+			groups = append(groups, g)
+		}
+		writeXML(w, struct {
+			XMLName xml.Name     `xml:"DescribeSecurityGroupsResponse"`
+			Groups  []*fakeGroup `xml:"securityGroupInfo>item"`
+		}{Groups: groups})
+	case "AuthorizeSecurityGroupIngress", "RevokeSecurityGroupIngress":
+		g := f.group(r.Form.Get("GroupId"))
+		if g == nil {
+			http.Error(w, "unknown group", http.StatusBadRequest)
+			return
+		}
+		rule := f.rule(g, r.Form.Get("IpPermissions.1.IpProtocol"), r.Form.Get("IpPermissions.1.FromPort"))
+		for i := 1; ; i++ {
+			cidr := r.Form.Get(fmt.Sprintf("IpPermissions.1.IpRanges.%d.CidrIp", i))
+			if cidr == "" {
+				break
+			}
+			if action == "AuthorizeSecurityGroupIngress" {
+				rule.Ranges = append(rule.Ranges, cidr)
+				continue
+			}
+			for idx, existing := range rule.Ranges {
+				if existing == cidr {
+					rule.Ranges = append(rule.Ranges[:idx], rule.Ranges[idx+1:]...)
+					break
+				}
+			}
+		}
+		writeXML(w, struct {
+			XMLName xml.Name
+			Return  bool `xml:"return"`
+		}{XMLName: xml.Name{Local: action + "Response"}, Return: true})
+	default:
+		http.Error(w, "unsupported action: "+action, http.StatusBadRequest)
+	}
+}
+
+func (f *fakeEC2) group(id string) *fakeGroup {
+	for _, g := range f.groups {
+		if g.ID == id {
+			return g
+		}
+	}
+	return nil
+}
+
+func (f *fakeEC2) rule(g *fakeGroup, protocol, fromPort string) *fakeRule {
+	port, _ := strconv.Atoi(fromPort)
+	for idx := range g.Rules {
+		if g.Rules[idx].Protocol == protocol && g.Rules[idx].FromPort == port {
+			return &g.Rules[idx]
+		}
+	}
+	g.Rules = append(g.Rules, fakeRule{Protocol: protocol, FromPort: port, ToPort: port})
+	return &g.Rules[len(g.Rules)-1]
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "text/xml")
+	xml.NewEncoder(w).Encode(v)
+}
+
+func newTestClient(t *testing.T, fake *fakeEC2) *Client {
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	return &Client{conn: ec2.New(ec2.Options{
+		Region:       "us-west-2",
+		BaseEndpoint: aws.String(srv.URL),
+		Credentials:  credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+	})}
+}
+
+func TestClient_List(t *testing.T) {
+	is := is.New(t)
+	client := newTestClient(t, &fakeEC2{groups: []*fakeGroup{
+		{ID: "sg-1", Name: "dev-vm", Rules: []fakeRule{
+			{Protocol: "tcp", FromPort: 22, ToPort: 22, Ranges: []string{"1.1.1.1/32", "2.2.2.2/32"}},
+			{Protocol: "tcp", FromPort: 443, ToPort: 443, Ranges: []string{"2.2.2.2/32"}},
+			{Protocol: "-1", Groups: []string{"sg-1"}},
+		}},
+		{ID: "sg-2", Name: "empty"},
+	}})
+
+	got, err := client.List(context.Background())
+	is.NoErr(err)
+	is.Equal(len(got), 2)
+	is.Equal(got[0].Name, "dev-vm")
+	is.Equal(got[0].AllowedIPv4Addresses, []string{"1.1.1.1/32", "2.2.2.2/32"})
+	is.Equal(got[0].Rules, []string{"tcp/22", "tcp/443"}) // the self-referencing rule can't be managed
+	is.Equal(got[0].Misc["id"], "sg-1")
+	is.Equal(got[1].Name, "empty")
+	is.Equal(got[1].AllowedIPv4Addresses, []string{})
+	is.Equal(got[1].Rules, []string{})
+}
+
+func TestClient_Get(t *testing.T) {
+	tests := []struct {
+		description string
+		name        string
+		expectErr   bool
+	}{
+		{
+			description: "security group exists",
+			name:        "dev-vm",
+		},
+		{
+			description: "security group does not exist",
+			name:        "missing",
+			expectErr:   true,
+		},
+		{
+			description: "security group name is ambiguous",
+			name:        "duplicate",
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			client := newTestClient(t, &fakeEC2{groups: []*fakeGroup{
+				{ID: "sg-1", Name: "dev-vm", Rules: []fakeRule{{Protocol: "tcp", FromPort: 22, ToPort: 22, Ranges: []string{"1.1.1.1/32"}}}},
+				{ID: "sg-2", Name: "duplicate"},
+				{ID: "sg-3", Name: "duplicate"},
+			}})
+
+			got, err := client.Get(context.Background(), tc.name)
+			if tc.expectErr {
+				is.True(err != nil)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(got.Name, tc.name)
+			is.Equal(got.AllowedIPv4Addresses, []string{"1.1.1.1/32"})
+		})
+	}
+}
+
+func TestClient_Update(t *testing.T) {
+	is := is.New(t)
+	fake := &fakeEC2{groups: []*fakeGroup{
+		{ID: "sg-1", Name: "dev-vm", Rules: []fakeRule{
+			{Protocol: "tcp", FromPort: 22, ToPort: 22, Ranges: []string{"1.1.1.1/32", "2.2.2.2/32"}},
+		}},
+	}}
+	client := newTestClient(t, fake)
+
+	err := client.Update(context.Background(), "dev-vm", []string{"2.2.2.2/32", "3.3.3.3/32"})
+	is.NoErr(err)
+	is.Equal(fake.calls, []string{"DescribeSecurityGroups", "AuthorizeSecurityGroupIngress", "RevokeSecurityGroupIngress"})
+
+	rule := fake.groups[0].Rules[0]
+	is.Equal(rule.Protocol, "tcp") // protocol preserved
+	is.Equal(rule.FromPort, 22)    // port preserved
+	is.Equal(rule.Ranges, []string{"2.2.2.2/32", "3.3.3.3/32"})
+}
+
+func TestClient_Update_PerRule(t *testing.T) {
+	is := is.New(t)
+	fake := &fakeEC2{groups: []*fakeGroup{
+		{ID: "sg-1", Name: "dev-vm", Rules: []fakeRule{
+			{Protocol: "tcp", FromPort: 22, ToPort: 22, Ranges: []string{"1.1.1.1/32"}},
+			{Protocol: "tcp", FromPort: 443, ToPort: 443, Ranges: []string{"0.0.0.0/0"}},
+		}},
+	}}
+	client := newTestClient(t, fake)
+
+	// what fwsync writes when replacing the owned 1.1.1.1 with 2.2.2.2 while keeping foreign ranges.
+	fw, err := client.Get(context.Background(), "dev-vm")
+	is.NoErr(err)
+	merged := generic.Merge(fw.AllowedIPv4Addresses, []string{"1.1.1.1/32"}, []string{"2.2.2.2/32"})
+	is.Equal(merged, []string{"0.0.0.0/0", "2.2.2.2/32"})
+
+	err = client.Update(context.Background(), "dev-vm", merged)
+	is.NoErr(err)
+	is.Equal(fake.groups[0].Rules[0].Ranges, []string{"2.2.2.2/32"})              // SSH is not opened to the world
+	is.Equal(fake.groups[0].Rules[1].Ranges, []string{"0.0.0.0/0", "2.2.2.2/32"}) // HTTPS doesn't lose 0.0.0.0/0
+}
+
+func TestClient_Update_EmptyRule(t *testing.T) {
+	is := is.New(t)
+	fake := &fakeEC2{groups: []*fakeGroup{
+		{ID: "sg-1", Name: "dev-vm", Rules: []fakeRule{
+			{Protocol: "tcp", FromPort: 22, ToPort: 22, Ranges: []string{"1.1.1.1/32"}},
+			{Protocol: "tcp", FromPort: 443, ToPort: 443, Ranges: []string{"0.0.0.0/0"}},
+		}},
+	}}
+	client := newTestClient(t, fake)
+
+	err := client.Update(context.Background(), "dev-vm", []string{"0.0.0.0/0"})
+	is.True(err != nil)
+	is.Equal(fake.calls, []string{"DescribeSecurityGroups"}) // nothing is written
+}
+
+func TestClient_Update_SkipsGroupRules(t *testing.T) {
+	is := is.New(t)
+	fake := &fakeEC2{groups: []*fakeGroup{
+		{ID: "sg-1", Name: "default", Rules: []fakeRule{
+			{Protocol: "-1", Groups: []string{"sg-1"}},
+			{Protocol: "tcp", FromPort: 22, ToPort: 22, Ranges: []string{"1.1.1.1/32"}},
+		}},
+	}}
+	client := newTestClient(t, fake)
+
+	err := client.Update(context.Background(), "default", []string{"2.2.2.2/32"})
+	is.NoErr(err)
+	is.Equal(fake.groups[0].Rules[0].Ranges, []string(nil)) // all traffic is still only allowed from the group
+	is.Equal(fake.groups[0].Rules[1].Ranges, []string{"2.2.2.2/32"})
+}
+
+func TestClient_Update_Rule(t *testing.T) {
+	is := is.New(t)
+	fake := &fakeEC2{groups: []*fakeGroup{
+		{ID: "sg-1", Name: "dev-vm", Rules: []fakeRule{
+			{Protocol: "tcp", FromPort: 22, ToPort: 22, Ranges: []string{"1.1.1.1/32"}},
+			{Protocol: "tcp", FromPort: 8000, ToPort: 8080, Ranges: []string{"1.1.1.1/32"}},
+		}},
+	}}
+	client := newTestClient(t, fake)
+	client.rule = "tcp/8000-8080"
+
+	fw, err := client.Get(context.Background(), "dev-vm")
+	is.NoErr(err)
+	is.Equal(fw.AllowedIPv4Addresses, []string{"1.1.1.1/32"})
+
+	err = client.Update(context.Background(), "dev-vm", []string{"2.2.2.2/32"})
+	is.NoErr(err)
+	is.Equal(fake.groups[0].Rules[0].Ranges, []string{"1.1.1.1/32"}) // not managed
+	is.Equal(fake.groups[0].Rules[1].Ranges, []string{"2.2.2.2/32"})
+
+	client.rule = "udp/53"
+	_, err = client.Get(context.Background(), "dev-vm")
+	is.True(err != nil)
+}
+
+func TestClient_Update_NoRules(t *testing.T) {
+	is := is.New(t)
+	client := newTestClient(t, &fakeEC2{groups: []*fakeGroup{
+		{ID: "sg-1", Name: "dev-vm"},
+		{ID: "sg-2", Name: "default", Rules: []fakeRule{{Protocol: "-1", Groups: []string{"sg-2"}}}},
+	}})
+
+	err := client.Update(context.Background(), "dev-vm", []string{"1.1.1.1/32"})
+	is.True(err != nil)
+	err = client.Update(context.Background(), "default", []string{"1.1.1.1/32"})
+	is.True(err != nil)
+}
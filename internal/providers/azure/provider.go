@@ -0,0 +1,194 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v6"
+	"github.com/jharshman/fwsync/internal/providers/generic"
+)
+
+// Client is an implementation of generic.Provider for Azure Network Security Groups.
+// fwsync manages the source address prefixes of a single inbound security rule on the group.
+type Client struct {
+	groups        *armnetwork.SecurityGroupsClient
+	rules         *armnetwork.SecurityRulesClient
+	resourceGroup string
+	rule          string
+}
+
+// New returns a new Client scoped to the given subscription and resource group. The rule is the name
+// of the inbound security rule managed by fwsync and may be empty when only listing groups.
+func New(subscription, resourceGroup, rule string) (*Client, error) {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	factory, err := armnetwork.NewClientFactory(subscription, cred, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		groups:        factory.NewSecurityGroupsClient(),
+		rules:         factory.NewSecurityRulesClient(),
+		resourceGroup: resourceGroup,
+		rule:          rule,
+	}, nil
+}
+
+// List returns all the Network Security Groups in the resource group along with the names
+// of their inbound allow rules.
+func (c *Client) List(ctx context.Context) ([]generic.Firewall, error) {
+	var fws []generic.Firewall
+	pager := c.groups.NewListPager(c.resourceGroup, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, nsg := range page.Value {
+			fw := generic.Firewall{Name: deref(nsg.Name), Rules: []string{}}
+			for _, rule := range inboundRules(nsg) {
+				fw.Rules = append(fw.Rules, deref(rule.Name))
+				if deref(rule.Name) == c.rule {
+					fw.AllowedIPv4Addresses, fw.AllowedIPv6Addresses = generic.SplitByFamily(sourcePrefixes(rule))
+				}
+			}
+			fws = append(fws, fw)
+		}
+	}
+
+	return fws, nil
+}
+
+// Get returns the Network Security Group by name with the source address prefixes of the managed rule.
+func (c *Client) Get(ctx context.Context, name string) (*generic.Firewall, error) {
+	res, err := c.groups.Get(ctx, c.resourceGroup, name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	fw := &generic.Firewall{Name: deref(res.Name)}
+	var managed *armnetwork.SecurityRule
+	for _, rule := range inboundRules(&res.SecurityGroup) {
+		fw.Rules = append(fw.Rules, deref(rule.Name))
+		if deref(rule.Name) == c.rule {
+			managed = rule
+		}
+	}
+
+	if managed == nil {
+		return nil, fmt.Errorf("network security group: %s has no inbound allow rule named %q", name, c.rule)
+	}
+
+	fw.AllowedIPv4Addresses, fw.AllowedIPv6Addresses = generic.SplitByFamily(sourcePrefixes(managed))
+	fw.Misc = map[string]any{"id": deref(res.ID), "rule": c.rule}
+	return fw, nil
+}
+
+// Update sets the source address prefixes of the managed inbound rule to sourceRanges. All other
+// properties of the rule, such as ports, protocol and priority, are preserved. Sources that are not
+// addresses, such as * or service tags, can't be written next to addresses and are refused.
+func (c *Client) Update(ctx context.Context, name string, sourceRanges []string) error {
+	if c.rule == "" {
+		return fmt.Errorf("no security rule configured for network security group: %s", name)
+	}
+	for _, r := range sourceRanges {
+		if !isAddress(r) {
+			return fmt.Errorf("security rule: %s allows %q, which is not an address range: "+
+				"remove it from the rule or sync with --overwrite to replace it", c.rule, r)
+		}
+	}
+
+	res, err := c.rules.Get(ctx, c.resourceGroup, name, c.rule, nil)
+	if err != nil {
+		return err
+	}
+
+	rule := res.SecurityRule
+	if rule.Properties == nil {
+		return fmt.Errorf("security rule: %s has no properties", c.rule)
+	}
+
+	// Azure only allows one of SourceAddressPrefix and SourceAddressPrefixes to be set.
+	rule.Properties.SourceAddressPrefix = nil
+	rule.Properties.SourceAddressPrefixes = to.SliceOfPtrs(sourceRanges...)
+
+	poller, err := c.rules.BeginCreateOrUpdate(ctx, c.resourceGroup, name, c.rule, rule, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = poller.PollUntilDone(ctx, nil)
+	return err
+}
+
+// AddressFormat reports that Azure source address prefixes are written as bare IPs for single hosts,
+// matching how they are displayed in the Azure portal.
+func (c *Client) AddressFormat() generic.AddressFormat {
+	return generic.FormatBare
+}
+
+// inboundRules returns the user defined inbound rules of a Network Security Group that allow traffic.
+// Deny rules are left out, adding an IP to one would block it.
+func inboundRules(nsg *armnetwork.SecurityGroup) []*armnetwork.SecurityRule {
+	if nsg.Properties == nil {
+		return nil
+	}
+
+	var rules []*armnetwork.SecurityRule
+	for _, rule := range nsg.Properties.SecurityRules {
+		p := rule.Properties
+		if p == nil || p.Direction == nil || p.Access == nil {
+			continue
+		}
+		if *p.Direction == armnetwork.SecurityRuleDirectionInbound && *p.Access == armnetwork.SecurityRuleAccessAllow {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// sourcePrefixes returns the source addresses of a rule regardless of whether they are held
+// in the singular or plural field.
+func sourcePrefixes(rule *armnetwork.SecurityRule) []string {
+	if rule.Properties == nil {
+		return nil
+	}
+
+	if len(rule.Properties.SourceAddressPrefixes) > 0 {
+		addrs := make([]string, 0, len(rule.Properties.SourceAddressPrefixes))
+		for _, p := range rule.Properties.SourceAddressPrefixes {
+			addrs = append(addrs, deref(p))
+		}
+		return addrs
+	}
+
+	if rule.Properties.SourceAddressPrefix != nil {
+		return []string{*rule.Properties.SourceAddressPrefix}
+	}
+
+	return nil
+}
+
+// isAddress reports whether the source is an IP or CIDR range rather than e.g. * or a service tag.
+func isAddress(source string) bool {
+	if _, err := netip.ParsePrefix(source); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(source)
+	return err == nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,234 @@
+package azure
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	azfake "github.com/Azure/azure-sdk-for-go/sdk/azcore/fake"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v6"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/network/armnetwork/v6/fake"
+	"github.com/matryer/is"
+)
+
+func testRule(name string, direction armnetwork.SecurityRuleDirection, prefixes ...string) *armnetwork.SecurityRule {
+	return &armnetwork.SecurityRule{
+		Name: to.Ptr(name),
+		Properties: &armnetwork.SecurityRulePropertiesFormat{
+			Access:                to.Ptr(armnetwork.SecurityRuleAccessAllow),
+			Direction:             to.Ptr(direction),
+			Protocol:              to.Ptr(armnetwork.SecurityRuleProtocolTCP),
+			DestinationPortRange:  to.Ptr("22"),
+			Priority:              to.Ptr[int32](100),
+			SourceAddressPrefixes: to.SliceOfPtrs(prefixes...),
+		},
+	}
+}
+
+func denyRule(name string, prefixes ...string) *armnetwork.SecurityRule {
+	rule := testRule(name, armnetwork.SecurityRuleDirectionInbound, prefixes...)
+	rule.Properties.Access = to.Ptr(armnetwork.SecurityRuleAccessDeny)
+	return rule
+}
+
+func testGroup() armnetwork.SecurityGroup {
+	return armnetwork.SecurityGroup{
+		ID:   to.Ptr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkSecurityGroups/dev-vm"),
+		Name: to.Ptr("dev-vm"),
+		Properties: &armnetwork.SecurityGroupPropertiesFormat{
+			SecurityRules: []*armnetwork.SecurityRule{
+				testRule("ssh", armnetwork.SecurityRuleDirectionInbound, "1.1.1.1/32", "2.2.2.2/32"),
+				testRule("https", armnetwork.SecurityRuleDirectionInbound, "3.3.3.3/32"),
+				testRule("egress", armnetwork.SecurityRuleDirectionOutbound, "0.0.0.0/0"),
+				denyRule("blocklist", "6.6.6.6/32"),
+			},
+		},
+	}
+}
+
+func newTestClient(t *testing.T, rule string, groups *fake.SecurityGroupsServer, rules *fake.SecurityRulesServer) *Client {
+	is := is.New(t)
+	options := func(transport policy.Transporter) *arm.ClientOptions {
+		return &arm.ClientOptions{ClientOptions: azcore.ClientOptions{Transport: transport}}
+	}
+
+	groupsClient, err := armnetwork.NewSecurityGroupsClient("sub", &azfake.TokenCredential{}, options(fake.NewSecurityGroupsServerTransport(groups)))
+	is.NoErr(err)
+	rulesClient, err := armnetwork.NewSecurityRulesClient("sub", &azfake.TokenCredential{}, options(fake.NewSecurityRulesServerTransport(rules)))
+	is.NoErr(err)
+
+	return &Client{groups: groupsClient, rules: rulesClient, resourceGroup: "rg", rule: rule}
+}
+
+func TestClient_List(t *testing.T) {
+	is := is.New(t)
+	groups := &fake.SecurityGroupsServer{
+		NewListPager: func(resourceGroupName string, options *armnetwork.SecurityGroupsClientListOptions) (resp azfake.PagerResponder[armnetwork.SecurityGroupsClientListResponse]) {
+			is.Equal(resourceGroupName, "rg")
+			resp.AddPage(http.StatusOK, armnetwork.SecurityGroupsClientListResponse{
+				SecurityGroupListResult: armnetwork.SecurityGroupListResult{Value: []*armnetwork.SecurityGroup{to.Ptr(testGroup())}},
+			}, nil)
+			return
+		},
+	}
+	client := newTestClient(t, "", groups, &fake.SecurityRulesServer{})
+
+	got, err := client.List(context.Background())
+	is.NoErr(err)
+	is.Equal(len(got), 1)
+	is.Equal(got[0].Name, "dev-vm")
+	is.Equal(got[0].Rules, []string{"ssh", "https"}) // outbound and deny rules are not listed
+}
+
+func TestClient_Get(t *testing.T) {
+	tests := []struct {
+		description string
+		rule        string
+		expectIPs   []string
+		expectErr   bool
+	}{
+		{
+			description: "managed rule exists",
+			rule:        "ssh",
+			expectIPs:   []string{"1.1.1.1/32", "2.2.2.2/32"},
+		},
+		{
+			description: "managed rule does not exist",
+			rule:        "rdp",
+			expectErr:   true,
+		},
+		{
+			description: "managed rule is outbound",
+			rule:        "egress",
+			expectErr:   true,
+		},
+		{
+			description: "managed rule denies traffic",
+			rule:        "blocklist",
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			groups := &fake.SecurityGroupsServer{
+				Get: func(ctx context.Context, resourceGroupName string, networkSecurityGroupName string, options *armnetwork.SecurityGroupsClientGetOptions) (resp azfake.Responder[armnetwork.SecurityGroupsClientGetResponse], errResp azfake.ErrorResponder) {
+					resp.SetResponse(http.StatusOK, armnetwork.SecurityGroupsClientGetResponse{SecurityGroup: testGroup()}, nil)
+					return
+				},
+			}
+			client := newTestClient(t, tc.rule, groups, &fake.SecurityRulesServer{})
+
+			got, err := client.Get(context.Background(), "dev-vm")
+			if tc.expectErr {
+				is.True(err != nil)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(got.AllowedIPv4Addresses, tc.expectIPs)
+		})
+	}
+}
+
+func TestClient_Update(t *testing.T) {
+	is := is.New(t)
+	var written armnetwork.SecurityRule
+	rules := &fake.SecurityRulesServer{
+		Get: func(ctx context.Context, resourceGroupName string, networkSecurityGroupName string, securityRuleName string, options *armnetwork.SecurityRulesClientGetOptions) (resp azfake.Responder[armnetwork.SecurityRulesClientGetResponse], errResp azfake.ErrorResponder) {
+			rule := testRule("ssh", armnetwork.SecurityRuleDirectionInbound)
+			rule.Properties.SourceAddressPrefix = to.Ptr("1.1.1.1/32")
+			resp.SetResponse(http.StatusOK, armnetwork.SecurityRulesClientGetResponse{SecurityRule: *rule}, nil)
+			return
+		},
+		BeginCreateOrUpdate: func(ctx context.Context, resourceGroupName string, networkSecurityGroupName string, securityRuleName string, securityRuleParameters armnetwork.SecurityRule, options *armnetwork.SecurityRulesClientBeginCreateOrUpdateOptions) (resp azfake.PollerResponder[armnetwork.SecurityRulesClientCreateOrUpdateResponse], errResp azfake.ErrorResponder) {
+			is.Equal(securityRuleName, "ssh")
+			written = securityRuleParameters
+			resp.SetTerminalResponse(http.StatusOK, armnetwork.SecurityRulesClientCreateOrUpdateResponse{SecurityRule: securityRuleParameters}, nil)
+			return
+		},
+	}
+	client := newTestClient(t, "ssh", &fake.SecurityGroupsServer{}, rules)
+
+	err := client.Update(context.Background(), "dev-vm", []string{"2.2.2.2/32", "3.3.3.3/32"})
+	is.NoErr(err)
+	is.True(written.Properties.SourceAddressPrefix == nil)
+	is.Equal(sourcePrefixes(&written), []string{"2.2.2.2/32", "3.3.3.3/32"})
+	is.Equal(*written.Properties.DestinationPortRange, "22") // port preserved
+	is.Equal(*written.Properties.Priority, int32(100))       // priority preserved
+}
+
+func TestClient_Update_NotAddress(t *testing.T) {
+	tests := []struct {
+		description string
+		source      string
+		ranges      []string
+		expectErr   bool
+	}{
+		{
+			description: "any source is kept by a merge",
+			source:      "*",
+			ranges:      []string{"*", "2.2.2.2/32"},
+			expectErr:   true,
+		},
+		{
+			description: "service tag is kept by a merge",
+			source:      "AzureCloud",
+			ranges:      []string{"AzureCloud", "2.2.2.2/32"},
+			expectErr:   true,
+		},
+		{
+			description: "system tag is kept by a merge",
+			source:      "Internet",
+			ranges:      []string{"2.2.2.2/32", "Internet"},
+			expectErr:   true,
+		},
+		{
+			description: "any source is replaced on overwrite",
+			source:      "*",
+			ranges:      []string{"2.2.2.2/32"},
+		},
+		{
+			description: "service tag is replaced on overwrite",
+			source:      "AzureCloud",
+			ranges:      []string{"2.2.2.2/32"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			var written *armnetwork.SecurityRule
+			rules := &fake.SecurityRulesServer{
+				Get: func(ctx context.Context, resourceGroupName string, networkSecurityGroupName string, securityRuleName string, options *armnetwork.SecurityRulesClientGetOptions) (resp azfake.Responder[armnetwork.SecurityRulesClientGetResponse], errResp azfake.ErrorResponder) {
+					rule := testRule("ssh", armnetwork.SecurityRuleDirectionInbound)
+					rule.Properties.SourceAddressPrefix = to.Ptr(tc.source)
+					resp.SetResponse(http.StatusOK, armnetwork.SecurityRulesClientGetResponse{SecurityRule: *rule}, nil)
+					return
+				},
+				BeginCreateOrUpdate: func(ctx context.Context, resourceGroupName string, networkSecurityGroupName string, securityRuleName string, securityRuleParameters armnetwork.SecurityRule, options *armnetwork.SecurityRulesClientBeginCreateOrUpdateOptions) (resp azfake.PollerResponder[armnetwork.SecurityRulesClientCreateOrUpdateResponse], errResp azfake.ErrorResponder) {
+					written = &securityRuleParameters
+					resp.SetTerminalResponse(http.StatusOK, armnetwork.SecurityRulesClientCreateOrUpdateResponse{SecurityRule: securityRuleParameters}, nil)
+					return
+				},
+			}
+			client := newTestClient(t, "ssh", &fake.SecurityGroupsServer{}, rules)
+
+			err := client.Update(context.Background(), "dev-vm", tc.ranges)
+			if tc.expectErr {
+				is.True(err != nil)
+				is.True(written == nil) // the rule is left open as it was, not half synced
+				return
+			}
+			is.NoErr(err)
+			is.True(written.Properties.SourceAddressPrefix == nil)
+			is.Equal(sourcePrefixes(written), []string{"2.2.2.2/32"})
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package digitalocean
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/digitalocean/godo"
+	"github.com/jharshman/fwsync/internal/providers/generic"
+)
+
+const tokenEnv = "DIGITALOCEAN_TOKEN"
+
+// Client is an implementation of generic.Provider for DigitalOcean Cloud Firewalls.
+// fwsync manages the source addresses of one inbound rule in the Cloud Firewall, or of every
+// inbound rule allowing addresses when no rule is configured. Rules whose sources are only tags,
+// Droplets or Load Balancers are never managed. Ports, protocols and any non-address sources are left untouched.
+type Client struct {
+	conn *godo.Client
+	rule string
+}
+
+// New returns a new Client authenticated with the token held in the DIGITALOCEAN_TOKEN environment variable.
+// The rule names the inbound rule managed by fwsync by its protocol and ports, e.g. tcp/22.
+func New(rule string) (*Client, error) {
+	token, ok := os.LookupEnv(tokenEnv)
+	if !ok || token == "" {
+		return nil, fmt.Errorf("%s environment variable not set", tokenEnv)
+	}
+
+	return &Client{conn: godo.NewFromToken(token), rule: rule}, nil
+}
+
+// List returns all the Cloud Firewalls in the account along with the names of their inbound
+// rules allowing addresses.
+func (c *Client) List(ctx context.Context) ([]generic.Firewall, error) {
+	firewalls, err := c.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fws := make([]generic.Firewall, 0, len(firewalls))
+	for _, fw := range firewalls {
+		rules := make([]string, 0, len(fw.InboundRules))
+		for _, rule := range fw.InboundRules {
+			if hasAddresses(rule) {
+				rules = append(rules, ruleName(rule))
+			}
+		}
+
+		managed, _ := c.managedRules(fw)
+		out := toFirewall(fw, managed)
+		out.Rules = rules
+		fws = append(fws, out)
+	}
+
+	return fws, nil
+}
+
+// Get searches for a Cloud Firewall by name and returns it as a *generic.Firewall holding the
+// source addresses of the managed inbound rules.
+func (c *Client) Get(ctx context.Context, name string) (*generic.Firewall, error) {
+	fw, err := c.firewall(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	managed, err := c.managedRules(*fw)
+	if err != nil {
+		return nil, fmt.Errorf("firewall: %s: %w", name, err)
+	}
+
+	out := toFirewall(*fw, managed)
+	return &out, nil
+}
+
+// Update replaces the source addresses allowed across the managed inbound rules with sourceRanges, see generic.RuleRanges.
+// The DigitalOcean API replaces the whole firewall on update, so everything else is written back as it was read.
+func (c *Client) Update(ctx context.Context, name string, sourceRanges []string) error {
+	fw, err := c.firewall(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	managed, err := c.managedRules(*fw)
+	if err != nil {
+		return fmt.Errorf("firewall: %s: %w", name, err)
+	}
+
+	current := toFirewall(*fw, managed)
+	previous := append(current.AllowedIPv4Addresses, current.AllowedIPv6Addresses...)
+
+	inbound := slices.Clone(fw.InboundRules)
+	for _, idx := range managed {
+		sources := *inbound[idx].Sources
+		sources.Addresses = generic.RuleRanges(sources.Addresses, previous, sourceRanges)
+		if len(sources.Addresses)+len(sources.Tags)+len(sources.DropletIDs)+
+			len(sources.LoadBalancerUIDs)+len(sources.KubernetesIDs) == 0 {
+			return fmt.Errorf("firewall: %s: rule %s would be left without sources", name, ruleName(inbound[idx]))
+		}
+		inbound[idx].Sources = &sources
+	}
+
+	_, _, err = c.conn.Firewalls.Update(ctx, fw.ID, &godo.FirewallRequest{
+		Name:          fw.Name,
+		InboundRules:  inbound,
+		OutboundRules: fw.OutboundRules,
+		DropletIDs:    fw.DropletIDs,
+		Tags:          fw.Tags,
+	})
+	return err
+}
+
+// AddressFormat reports that DigitalOcean source addresses are written in CIDR notation.
+func (c *Client) AddressFormat() generic.AddressFormat {
+	return generic.FormatCIDR
+}
+
+// managedRules returns the indexes of the inbound rules named by c.rule or, when no rule is configured,
+// of every inbound rule allowing addresses. Rules whose sources are only tags, Droplets or Load Balancers
+// are skipped: adding addresses to them would open their ports to those addresses.
+func (c *Client) managedRules(fw godo.Firewall) ([]int, error) {
+	var managed []int
+	for idx, rule := range fw.InboundRules {
+		if !hasAddresses(rule) {
+			continue
+		}
+		if c.rule != "" && ruleName(rule) != c.rule {
+			continue
+		}
+		managed = append(managed, idx)
+	}
+
+	if len(managed) > 0 {
+		return managed, nil
+	}
+	if c.rule != "" {
+		return nil, fmt.Errorf("no inbound rule %s allowing addresses", c.rule)
+	}
+	return nil, fmt.Errorf("no inbound rules allowing addresses")
+}
+
+// hasAddresses reports whether an inbound rule allows any source address.
+func hasAddresses(rule godo.InboundRule) bool {
+	return rule.Sources != nil && len(rule.Sources.Addresses) > 0
+}
+
+// ruleName identifies an inbound rule by its protocol and port range, e.g. tcp/22, tcp/8000-8080 or icmp.
+func ruleName(rule godo.InboundRule) string {
+	if rule.PortRange == "" {
+		return rule.Protocol
+	}
+	return rule.Protocol + "/" + rule.PortRange
+}
+
+// firewall looks up a single Cloud Firewall by its name.
+func (c *Client) firewall(ctx context.Context, name string) (*godo.Firewall, error) {
+	firewalls, err := c.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []godo.Firewall
+	for _, fw := range firewalls {
+		if fw.Name == name {
+			matches = append(matches, fw)
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no firewall found matching name: %s", name)
+	}
+
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("more than one firewall matching name: %s", name)
+	}
+
+	return &matches[0], nil
+}
+
+func (c *Client) list(ctx context.Context) ([]godo.Firewall, error) {
+	var firewalls []godo.Firewall
+	opt := &godo.ListOptions{}
+	for {
+		page, resp, err := c.conn.Firewalls.List(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		firewalls = append(firewalls, page...)
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			break
+		}
+
+		current, err := resp.Links.CurrentPage()
+		if err != nil {
+			return nil, err
+		}
+		opt.Page = current + 1
+	}
+	return firewalls, nil
+}
+
+// toFirewall collects the unique source addresses across the inbound rules of the Cloud Firewall at the managed indexes.
+func toFirewall(fw godo.Firewall, managed []int) generic.Firewall {
+	seen := make(map[string]bool)
+	addrs := []string{}
+	for _, idx := range managed {
+		for _, addr := range fw.InboundRules[idx].Sources.Addresses {
+			if seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+
+	ipv4, ipv6 := generic.SplitByFamily(addrs)
+	return generic.Firewall{
+		Name:                 fw.Name,
+		AllowedIPv4Addresses: ipv4,
+		AllowedIPv6Addresses: ipv6,
+		Misc:                 map[string]any{"id": fw.ID},
+	}
+}
@@ -0,0 +1,208 @@
+package digitalocean
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	"github.com/jharshman/fwsync/internal/providers/generic"
+	"github.com/matryer/is"
+)
+
+func testFirewalls() []godo.Firewall {
+	return []godo.Firewall{
+		{
+			ID:   "fw-1",
+			Name: "dev-vm",
+			InboundRules: []godo.InboundRule{
+				{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"1.1.1.1/32", "2.2.2.2/32"}}},
+				{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"2.2.2.2/32"}, Tags: []string{"lb"}}},
+				{Protocol: "tcp", PortRange: "8080", Sources: &godo.Sources{Tags: []string{"lb"}}},
+			},
+			OutboundRules: []godo.OutboundRule{
+				{Protocol: "tcp", PortRange: "all", Destinations: &godo.Destinations{Addresses: []string{"0.0.0.0/0"}}},
+			},
+			DropletIDs: []int{42},
+		},
+		{ID: "fw-2", Name: "duplicate"},
+		{ID: "fw-3", Name: "duplicate"},
+		{ID: "fw-4", Name: "empty"},
+		{
+			ID:   "fw-5",
+			Name: "tags-only",
+			InboundRules: []godo.InboundRule{
+				{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Tags: []string{"bastion"}}},
+			},
+		},
+		{
+			ID:   "fw-6",
+			Name: "web",
+			InboundRules: []godo.InboundRule{
+				{Protocol: "tcp", PortRange: "22", Sources: &godo.Sources{Addresses: []string{"1.1.1.1/32"}}},
+				{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"0.0.0.0/0"}}},
+			},
+		},
+	}
+}
+
+// newTestClient returns a Client backed by a stand-in for the DigitalOcean API. Firewall update
+// requests are decoded into the returned map keyed by firewall ID.
+func newTestClient(t *testing.T) (*Client, map[string]godo.FirewallRequest) {
+	updates := make(map[string]godo.FirewallRequest)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v2/firewalls", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"firewalls": testFirewalls(), "meta": map[string]int{"total": 6}})
+	})
+	mux.HandleFunc("PUT /v2/firewalls/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var req godo.FirewallRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		updates[r.PathValue("id")] = req
+		json.NewEncoder(w).Encode(map[string]any{"firewall": godo.Firewall{ID: r.PathValue("id"), Name: req.Name}})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	conn, err := godo.New(srv.Client(), godo.SetBaseURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Client{conn: conn}, updates
+}
+
+func TestClient_List(t *testing.T) {
+	is := is.New(t)
+	client, _ := newTestClient(t)
+
+	got, err := client.List(context.Background())
+	is.NoErr(err)
+	is.Equal(len(got), 6)
+	is.Equal(got[0].Name, "dev-vm")
+	is.Equal(got[0].AllowedIPv4Addresses, []string{"1.1.1.1/32", "2.2.2.2/32"})
+	is.Equal(got[0].Rules, []string{"tcp/22", "tcp/443"}) // the rule only allowing a tag can't be managed
+	is.Equal(got[0].Misc["id"], "fw-1")
+	is.Equal(got[1].AllowedIPv4Addresses, []string{})
+	is.Equal(got[4].Rules, []string{})
+}
+
+func TestClient_Get(t *testing.T) {
+	tests := []struct {
+		description string
+		name        string
+		expectErr   bool
+	}{
+		{
+			description: "firewall exists",
+			name:        "dev-vm",
+		},
+		{
+			description: "firewall does not exist",
+			name:        "missing",
+			expectErr:   true,
+		},
+		{
+			description: "firewall name is ambiguous",
+			name:        "duplicate",
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			client, _ := newTestClient(t)
+
+			got, err := client.Get(context.Background(), tc.name)
+			if tc.expectErr {
+				is.True(err != nil)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(got.Name, tc.name)
+		})
+	}
+}
+
+func TestClient_Update(t *testing.T) {
+	is := is.New(t)
+	client, updates := newTestClient(t)
+
+	err := client.Update(context.Background(), "dev-vm", []string{"3.3.3.3/32"})
+	is.NoErr(err)
+
+	got, ok := updates["fw-1"]
+	is.True(ok)
+	is.Equal(got.Name, "dev-vm")
+	is.Equal(len(got.InboundRules), 3)
+	is.Equal(got.InboundRules[0].PortRange, "22")  // ports preserved
+	is.Equal(got.InboundRules[1].PortRange, "443") // ports preserved
+	is.Equal(got.InboundRules[0].Sources.Addresses, []string{"3.3.3.3/32"})
+	is.Equal(got.InboundRules[1].Sources.Addresses, []string{"3.3.3.3/32"})
+	is.Equal(got.InboundRules[1].Sources.Tags, []string{"lb"})     // non-address sources preserved
+	is.Equal(got.InboundRules[2].Sources.Addresses, []string(nil)) // rules only allowing tags are not managed
+	is.Equal(got.InboundRules[2].Sources.Tags, []string{"lb"})
+	is.Equal(got.OutboundRules, testFirewalls()[0].OutboundRules)
+	is.Equal(got.DropletIDs, []int{42})
+}
+
+func TestClient_Update_PerRule(t *testing.T) {
+	is := is.New(t)
+	client, updates := newTestClient(t)
+
+	// what fwsync writes when replacing the owned 1.1.1.1 with 3.3.3.3 while keeping foreign addresses.
+	fw, err := client.Get(context.Background(), "web")
+	is.NoErr(err)
+	merged := generic.Merge(fw.AllowedIPv4Addresses, []string{"1.1.1.1/32"}, []string{"3.3.3.3/32"})
+	is.Equal(merged, []string{"0.0.0.0/0", "3.3.3.3/32"})
+
+	err = client.Update(context.Background(), "web", merged)
+	is.NoErr(err)
+	got := updates["fw-6"]
+	is.Equal(got.InboundRules[0].Sources.Addresses, []string{"3.3.3.3/32"})              // SSH is not opened to the world
+	is.Equal(got.InboundRules[1].Sources.Addresses, []string{"0.0.0.0/0", "3.3.3.3/32"}) // HTTPS doesn't lose 0.0.0.0/0
+}
+
+func TestClient_Update_EmptyRule(t *testing.T) {
+	is := is.New(t)
+	client, updates := newTestClient(t)
+
+	err := client.Update(context.Background(), "web", []string{"0.0.0.0/0"})
+	is.True(err != nil)
+	is.Equal(len(updates), 0) // nothing is written
+}
+
+func TestClient_Update_Rule(t *testing.T) {
+	is := is.New(t)
+	client, updates := newTestClient(t)
+	client.rule = "tcp/443"
+
+	fw, err := client.Get(context.Background(), "dev-vm")
+	is.NoErr(err)
+	is.Equal(fw.AllowedIPv4Addresses, []string{"2.2.2.2/32"})
+
+	err = client.Update(context.Background(), "dev-vm", []string{"3.3.3.3/32"})
+	is.NoErr(err)
+	got := updates["fw-1"]
+	is.Equal(got.InboundRules[0].Sources.Addresses, []string{"1.1.1.1/32", "2.2.2.2/32"}) // not managed
+	is.Equal(got.InboundRules[1].Sources.Addresses, []string{"3.3.3.3/32"})
+
+	client.rule = "udp/53"
+	_, err = client.Get(context.Background(), "dev-vm")
+	is.True(err != nil)
+}
+
+func TestClient_Update_NoRules(t *testing.T) {
+	is := is.New(t)
+	client, _ := newTestClient(t)
+
+	err := client.Update(context.Background(), "empty", []string{"3.3.3.3/32"})
+	is.True(err != nil)
+	err = client.Update(context.Background(), "tags-only", []string{"3.3.3.3/32"})
+	is.True(err != nil)
+}
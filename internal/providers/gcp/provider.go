@@ -2,9 +2,16 @@ package gcp
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/jharshman/fwsync/internal/providers/generic"
 	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
 )
 
 // Client is a simple type containing a GCP client connection to compute.Service. This
@@ -12,31 +19,37 @@ import (
 type Client struct {
 	conn    *compute.Service
 	project string
+	// how often to poll long-running operations for completion.
+	pollInterval time.Duration
 }
 
+const defaultPollInterval = time.Second
+
 // New creates a new instance of the Client.
-func New(project string) (*Client, error) {
-	conn, err := compute.NewService(context.Background())
+func New(project string, opts ...option.ClientOption) (*Client, error) {
+	conn, err := compute.NewService(context.Background(), opts...)
 	if err != nil {
 		return nil, err
 	}
-	return &Client{conn: conn, project: project}, nil
+	return &Client{conn: conn, project: project, pollInterval: defaultPollInterval}, nil
 }
 
 // List returns all the available Firewall Policies in the Project.
 // It distills that information into a simpler generic.Firewall type and
 // returns it to the caller.
 func (c *Client) List(ctx context.Context) ([]generic.Firewall, error) {
-	fw, err := c.conn.Firewalls.List(c.project).Do()
+	fw, err := c.conn.Firewalls.List(c.project).Context(ctx).Do()
 	if err != nil {
 		return nil, err
 	}
 
 	fws := make([]generic.Firewall, 0, len(fw.Items))
 	for _, item := range fw.Items {
+		ipv4, ipv6 := generic.SplitByFamily(item.SourceRanges)
 		fws = append(fws, generic.Firewall{
 			Name:                 item.Name,
-			AllowedIPv4Addresses: item.SourceRanges,
+			AllowedIPv4Addresses: ipv4,
+			AllowedIPv6Addresses: ipv6,
 		})
 	}
 
@@ -44,21 +57,100 @@ func (c *Client) List(ctx context.Context) ([]generic.Firewall, error) {
 }
 
 // Get returns a generic.Firewall if one exists by the given name parameter.
+// A fingerprint of the firewall's source ranges is stored in Misc["fingerprint"] for use with UpdateIfUnchanged.
 func (c *Client) Get(ctx context.Context, name string) (*generic.Firewall, error) {
-	fw, err := c.conn.Firewalls.Get(c.project, name).Do()
+	fw, err := c.conn.Firewalls.Get(c.project, name).Context(ctx).Do()
 	if err != nil {
 		return nil, err
 	}
 
+	ipv4, ipv6 := generic.SplitByFamily(fw.SourceRanges)
 	return &generic.Firewall{
 		Name:                 fw.Name,
-		AllowedIPv4Addresses: fw.SourceRanges,
+		AllowedIPv4Addresses: ipv4,
+		AllowedIPv6Addresses: ipv6,
+		Misc: map[string]any{
+			"fingerprint": fingerprint(fw),
+		},
 	}, nil
 }
 
 // Update performs a Patch operation on an existing Firewall and sets the SourceRanges of allowed IPs
-// to the provided parameter sourceRanges.
+// to the provided parameter sourceRanges. GCP holds both IPv4 and IPv6 ranges in SourceRanges.
+// It waits for the resulting operation to complete and returns its error, if any.
 func (c *Client) Update(ctx context.Context, name string, sourceRanges []string) error {
-	_, err := c.conn.Firewalls.Patch(c.project, name, &compute.Firewall{SourceRanges: sourceRanges}).Do()
-	return err
+	return c.patch(ctx, name, &compute.Firewall{SourceRanges: sourceRanges})
+}
+
+// UpdateIfUnchanged behaves like Update but returns an error wrapping generic.ErrConflict if the firewall's
+// fingerprint changed since Get. VPC firewall rules have no server side check, so a concurrent write can still slip in.
+func (c *Client) UpdateIfUnchanged(ctx context.Context, fw *generic.Firewall, sourceRanges []string) error {
+	want, _ := fw.Misc["fingerprint"].(string)
+	if want == "" {
+		return fmt.Errorf("firewall: %s has no fingerprint", fw.Name)
+	}
+
+	current, err := c.conn.Firewalls.Get(c.project, fw.Name).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	if fingerprint(current) != want {
+		return fmt.Errorf("firewall: %s: %w", fw.Name, generic.ErrConflict)
+	}
+
+	return c.patch(ctx, fw.Name, &compute.Firewall{SourceRanges: sourceRanges})
+}
+
+func (c *Client) patch(ctx context.Context, name string, fw *compute.Firewall) error {
+	op, err := c.conn.Firewalls.Patch(c.project, name, fw).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return c.wait(ctx, op)
+}
+
+// wait polls the global operation until it is DONE or ctx expires.
+// A completed operation that failed is returned as an error.
+func (c *Client) wait(ctx context.Context, op *compute.Operation) error {
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+
+	for op.Status != "DONE" {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for operation: %s: %w", op.Name, ctx.Err())
+		case <-ticker.C:
+		}
+
+		next, err := c.conn.GlobalOperations.Get(c.project, op.Name).Context(ctx).Do()
+		if ctx.Err() != nil {
+			return fmt.Errorf("waiting for operation: %s: %w", op.Name, ctx.Err())
+		}
+		if err != nil {
+			return err
+		}
+		op = next
+	}
+
+	if op.Error == nil || len(op.Error.Errors) == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, len(op.Error.Errors))
+	for _, e := range op.Error.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", e.Code, e.Message))
+	}
+	return fmt.Errorf("operation: %s failed: %s", op.Name, strings.Join(msgs, "; "))
+}
+
+// fingerprint returns a digest of the firewall's source ranges. The order of the ranges is not significant.
+func fingerprint(fw *compute.Firewall) string {
+	ranges := slices.Clone(fw.SourceRanges)
+	slices.Sort(ranges)
+	sum := sha256.Sum256([]byte(strings.Join(ranges, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// AddressFormat reports that GCP source ranges are written in CIDR notation.
+func (c *Client) AddressFormat() generic.AddressFormat {
+	return generic.FormatCIDR
 }
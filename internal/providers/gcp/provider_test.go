@@ -0,0 +1,213 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jharshman/fwsync/internal/providers/generic"
+	"github.com/matryer/is"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+)
+
+// fakeCompute is a stand-in for the Compute Engine API holding firewalls keyed by name.
+// Patches complete immediately unless operations is set, in which case each poll of the
+// operation returns the next entry and the last entry is returned from then on.
+type fakeCompute struct {
+	firewalls  map[string]*compute.Firewall
+	patches    []compute.Firewall
+	operations []*compute.Operation
+	polls      int
+}
+
+func (f *fakeCompute) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /projects/{project}/global/firewalls", func(w http.ResponseWriter, r *http.Request) {
+		items := make([]*compute.Firewall, 0, len(f.firewalls))
+		for _, fw := range f.firewalls {
+			items = append(items, fw)
+		}
+		json.NewEncoder(w).Encode(compute.FirewallList{Items: items})
+	})
+	mux.HandleFunc("GET /projects/{project}/global/firewalls/{name}", func(w http.ResponseWriter, r *http.Request) {
+		fw, ok := f.firewalls[r.PathValue("name")]
+		if !ok {
+			http.Error(w, `{"error":{"code":404,"message":"not found"}}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(fw)
+	})
+	mux.HandleFunc("PATCH /projects/{project}/global/firewalls/{name}", func(w http.ResponseWriter, r *http.Request) {
+		var patch compute.Firewall
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.patches = append(f.patches, patch)
+		f.firewalls[r.PathValue("name")].SourceRanges = patch.SourceRanges
+		if len(f.operations) > 0 {
+			json.NewEncoder(w).Encode(compute.Operation{Name: "operation-1", Status: "PENDING"})
+			return
+		}
+		json.NewEncoder(w).Encode(compute.Operation{Name: "operation-1", Status: "DONE"})
+	})
+	mux.HandleFunc("GET /projects/{project}/global/operations/{operation}", func(w http.ResponseWriter, r *http.Request) {
+		op := f.operations[min(f.polls, len(f.operations)-1)]
+		f.polls++
+		json.NewEncoder(w).Encode(op)
+	})
+	return mux
+}
+
+func newTestClient(t *testing.T, fake *fakeCompute) *Client {
+	srv := httptest.NewServer(fake.handler())
+	t.Cleanup(srv.Close)
+
+	client, err := New("test-project",
+		option.WithEndpoint(srv.URL+"/"),
+		option.WithHTTPClient(srv.Client()),
+		option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.pollInterval = time.Millisecond
+	return client
+}
+
+func testCompute() *fakeCompute {
+	return &fakeCompute{
+		firewalls: map[string]*compute.Firewall{
+			"dev-vm": {Name: "dev-vm", SourceRanges: []string{"1.1.1.1/32", "2001:db8::/64"}},
+		},
+	}
+}
+
+func TestClient_Get(t *testing.T) {
+	is := is.New(t)
+	client := newTestClient(t, testCompute())
+
+	got, err := client.Get(context.Background(), "dev-vm")
+	is.NoErr(err)
+	is.Equal(got.Name, "dev-vm")
+	is.Equal(got.AllowedIPv4Addresses, []string{"1.1.1.1/32"})
+	is.Equal(got.AllowedIPv6Addresses, []string{"2001:db8::/64"})
+	is.True(got.Misc["fingerprint"] != "")
+
+	_, err = client.Get(context.Background(), "missing")
+	is.True(err != nil)
+}
+
+func TestClient_Update(t *testing.T) {
+	is := is.New(t)
+	fake := testCompute()
+	client := newTestClient(t, fake)
+
+	err := client.Update(context.Background(), "dev-vm", []string{"2.2.2.2/32"})
+	is.NoErr(err)
+	is.Equal(len(fake.patches), 1)
+	is.Equal(fake.patches[0].SourceRanges, []string{"2.2.2.2/32"})
+}
+
+func TestClient_Update_Operation(t *testing.T) {
+	tests := []struct {
+		description string
+		operations  []*compute.Operation
+		timeout     time.Duration
+		expectErr   string
+		expectPolls int
+	}{
+		{
+			description: "waits until done",
+			operations: []*compute.Operation{
+				{Name: "operation-1", Status: "RUNNING"},
+				{Name: "operation-1", Status: "RUNNING"},
+				{Name: "operation-1", Status: "DONE"},
+			},
+			expectPolls: 3,
+		},
+		{
+			description: "operation error",
+			operations: []*compute.Operation{
+				{Name: "operation-1", Status: "RUNNING"},
+				{Name: "operation-1", Status: "DONE", Error: &compute.OperationError{
+					Errors: []*compute.OperationErrorErrors{{Code: "INVALID_USAGE", Message: "invalid source range"}},
+				}},
+			},
+			expectErr:   "operation: operation-1 failed: INVALID_USAGE: invalid source range",
+			expectPolls: 2,
+		},
+		{
+			description: "never done",
+			operations: []*compute.Operation{
+				{Name: "operation-1", Status: "RUNNING"},
+			},
+			timeout:   50 * time.Millisecond,
+			expectErr: "waiting for operation: operation-1: context deadline exceeded",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			fake := testCompute()
+			fake.operations = tc.operations
+			client := newTestClient(t, fake)
+
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+
+			err := client.Update(ctx, "dev-vm", []string{"2.2.2.2/32"})
+			if tc.expectErr != "" {
+				is.True(err != nil)
+				is.Equal(err.Error(), tc.expectErr)
+			} else {
+				is.NoErr(err)
+			}
+			if tc.expectPolls > 0 {
+				is.Equal(fake.polls, tc.expectPolls)
+			}
+		})
+	}
+}
+
+func TestClient_UpdateIfUnchanged(t *testing.T) {
+	is := is.New(t)
+	fake := testCompute()
+	client := newTestClient(t, fake)
+
+	fw, err := client.Get(context.Background(), "dev-vm")
+	is.NoErr(err)
+
+	// a teammate modifies the firewall after it was read.
+	fake.firewalls["dev-vm"].SourceRanges = []string{"3.3.3.3/32"}
+
+	err = client.UpdateIfUnchanged(context.Background(), fw, []string{"2.2.2.2/32"})
+	is.True(errors.Is(err, generic.ErrConflict))
+	is.Equal(len(fake.patches), 0) // nothing is written on conflict
+
+	// re-read and retry.
+	fw, err = client.Get(context.Background(), "dev-vm")
+	is.NoErr(err)
+	err = client.UpdateIfUnchanged(context.Background(), fw, []string{"3.3.3.3/32", "2.2.2.2/32"})
+	is.NoErr(err)
+	is.Equal(fake.patches[0].SourceRanges, []string{"3.3.3.3/32", "2.2.2.2/32"})
+}
+
+func TestFingerprint(t *testing.T) {
+	is := is.New(t)
+	a := fingerprint(&compute.Firewall{SourceRanges: []string{"1.1.1.1/32", "2.2.2.2/32"}})
+	b := fingerprint(&compute.Firewall{SourceRanges: []string{"2.2.2.2/32", "1.1.1.1/32"}})
+	c := fingerprint(&compute.Firewall{SourceRanges: []string{"1.1.1.1/32"}})
+	is.Equal(a, b) // order is not significant
+	is.True(a != c)
+}
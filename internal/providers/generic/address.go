@@ -0,0 +1,75 @@
+package generic
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// AddressFormat describes how a provider expects source ranges to be written on the wire.
+type AddressFormat int
+
+const (
+	// FormatCIDR writes every range in CIDR notation, including single hosts such as 1.2.3.4/32.
+	FormatCIDR AddressFormat = iota
+	// FormatBare writes single hosts as bare IPs such as 1.2.3.4 and all other ranges in CIDR notation.
+	FormatBare
+)
+
+// ToWire converts ranges held in canonical CIDR form into the given provider format.
+// The input is never modified and values that cannot be parsed are passed through unchanged.
+func ToWire(ranges []string, format AddressFormat) []string {
+	out := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		prefix, err := parse(r)
+		if err != nil {
+			out = append(out, r)
+			continue
+		}
+
+		if format == FormatBare && prefix.IsSingleIP() {
+			out = append(out, prefix.Addr().String())
+			continue
+		}
+		out = append(out, prefix.String())
+	}
+	return out
+}
+
+// FromWire converts ranges read from a provider, in either format, into canonical CIDR form so they
+// can be compared with the local configuration. Values that cannot be parsed are passed through unchanged.
+func FromWire(ranges []string) []string {
+	return ToWire(ranges, FormatCIDR)
+}
+
+// SplitByFamily separates the given addresses or CIDR ranges into IPv4 and IPv6. Values that cannot
+// be parsed are considered IPv4 so they are passed along to the provider unchanged.
+func SplitByFamily(ranges []string) (ipv4 []string, ipv6 []string) {
+	ipv4, ipv6 = []string{}, []string{}
+	for _, r := range ranges {
+		addr, err := netip.ParseAddr(strings.SplitN(r, "/", 2)[0])
+		if err == nil && addr.Is6() && !addr.Is4In6() {
+			ipv6 = append(ipv6, r)
+			continue
+		}
+		ipv4 = append(ipv4, r)
+	}
+	return ipv4, ipv6
+}
+
+// parse reads a bare IP or CIDR range into a masked prefix. Bare IPs are treated as single hosts.
+func parse(r string) (netip.Prefix, error) {
+	if strings.Contains(r, "/") {
+		prefix, err := netip.ParsePrefix(r)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(r)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
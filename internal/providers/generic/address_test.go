@@ -0,0 +1,84 @@
+package generic
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestToWire(t *testing.T) {
+	tests := []struct {
+		description string
+		ranges      []string
+		format      AddressFormat
+		expect      []string
+	}{
+		{
+			description: "CIDR format keeps single hosts in CIDR notation",
+			ranges:      []string{"1.1.1.1/32", "2001:db8::1/128"},
+			format:      FormatCIDR,
+			expect:      []string{"1.1.1.1/32", "2001:db8::1/128"},
+		},
+		{
+			description: "CIDR format adds suffix to bare IPs",
+			ranges:      []string{"1.1.1.1", "2001:db8::1"},
+			format:      FormatCIDR,
+			expect:      []string{"1.1.1.1/32", "2001:db8::1/128"},
+		},
+		{
+			description: "bare format strips suffix from single hosts",
+			ranges:      []string{"1.1.1.1/32", "2001:db8::1/128"},
+			format:      FormatBare,
+			expect:      []string{"1.1.1.1", "2001:db8::1"},
+		},
+		{
+			description: "bare format keeps wider ranges in CIDR notation",
+			ranges:      []string{"10.0.0.0/8", "2001:db8::/64"},
+			format:      FormatBare,
+			expect:      []string{"10.0.0.0/8", "2001:db8::/64"},
+		},
+		{
+			description: "unparsable values pass through",
+			ranges:      []string{"Internet"},
+			format:      FormatCIDR,
+			expect:      []string{"Internet"},
+		},
+		{
+			description: "no ranges",
+			ranges:      nil,
+			format:      FormatCIDR,
+			expect:      []string{},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(ToWire(tc.ranges, tc.format), tc.expect)
+		})
+	}
+}
+
+func TestToWire_Idempotent(t *testing.T) {
+	is := is.New(t)
+	in := []string{"1.1.1.1/32", "2.2.2.2/32"}
+
+	once := ToWire(in, FormatCIDR)
+	twice := ToWire(once, FormatCIDR)
+	is.Equal(twice, []string{"1.1.1.1/32", "2.2.2.2/32"}) // never double suffixed
+	is.Equal(in, []string{"1.1.1.1/32", "2.2.2.2/32"})    // input not modified
+}
+
+func TestFromWire(t *testing.T) {
+	is := is.New(t)
+	got := FromWire([]string{"1.1.1.1", "10.1.2.3/8", "2001:DB8::1", "::ffff:2.2.2.2"})
+	is.Equal(got, []string{"1.1.1.1/32", "10.0.0.0/8", "2001:db8::1/128", "2.2.2.2/32"})
+}
+
+func TestSplitByFamily(t *testing.T) {
+	is := is.New(t)
+	ipv4, ipv6 := SplitByFamily([]string{"1.1.1.1/32", "2001:db8::/64", "2.2.2.2", "::1", "not-an-ip"})
+	is.Equal(ipv4, []string{"1.1.1.1/32", "2.2.2.2", "not-an-ip"})
+	is.Equal(ipv6, []string{"2001:db8::/64", "::1"})
+}
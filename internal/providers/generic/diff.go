@@ -0,0 +1,101 @@
+package generic
+
+// Changes describes how the source ranges on a firewall differ from the desired source ranges.
+type Changes struct {
+	// Ranges present in the desired set but missing from the firewall.
+	Added []string
+	// Ranges present on the firewall but missing from the desired set.
+	Removed []string
+	// Ranges present in both.
+	Unchanged []string
+}
+
+// Pending reports whether applying the desired ranges would change the firewall.
+func (c Changes) Pending() bool {
+	return len(c.Added) > 0 || len(c.Removed) > 0
+}
+
+// Diff compares the ranges currently on a firewall with the desired ranges. Both are converted to
+// canonical CIDR form first so that provider formatting differences are not reported as changes.
+func Diff(current, desired []string) Changes {
+	current, desired = FromWire(current), FromWire(desired)
+
+	have := make(map[string]bool, len(current))
+	for _, r := range current {
+		have[r] = true
+	}
+
+	changes := Changes{Added: []string{}, Removed: []string{}, Unchanged: []string{}}
+	want := make(map[string]bool, len(desired))
+	for _, r := range desired {
+		if want[r] {
+			continue
+		}
+		want[r] = true
+		if have[r] {
+			changes.Unchanged = append(changes.Unchanged, r)
+		} else {
+			changes.Added = append(changes.Added, r)
+		}
+	}
+
+	seen := make(map[string]bool, len(current))
+	for _, r := range current {
+		if !want[r] && !seen[r] {
+			changes.Removed = append(changes.Removed, r)
+		}
+		seen[r] = true
+	}
+
+	return changes
+}
+
+// Merge returns the ranges a firewall should have so that it allows the desired ranges while leaving
+// ranges fwsync does not own untouched. Ranges on the firewall that are owned but no longer desired
+// are dropped, every other range on the firewall is kept. All ranges are returned in canonical CIDR form.
+func Merge(current, owned, desired []string) []string {
+	current, owned, desired = FromWire(current), FromWire(owned), FromWire(desired)
+
+	want := make(map[string]bool, len(desired))
+	for _, r := range desired {
+		want[r] = true
+	}
+	stale := make(map[string]bool, len(owned))
+	for _, r := range owned {
+		if !want[r] {
+			stale[r] = true
+		}
+	}
+
+	merged := make([]string, 0, len(current)+len(desired))
+	seen := make(map[string]bool, len(current)+len(desired))
+	for _, r := range append(current, desired...) {
+		if stale[r] || seen[r] {
+			continue
+		}
+		seen[r] = true
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// RuleRanges applies the change from previous, the ranges allowed across all managed rules, to desired to a single
+// rule. Ranges only held by other rules are not copied onto it. All ranges are returned in canonical CIDR form.
+func RuleRanges(rule, previous, desired []string) []string {
+	changes := Diff(previous, desired)
+	removed := make(map[string]bool, len(changes.Removed))
+	for _, r := range changes.Removed {
+		removed[r] = true
+	}
+
+	ranges := make([]string, 0, len(rule)+len(changes.Added))
+	seen := make(map[string]bool, len(rule)+len(changes.Added))
+	for _, r := range append(FromWire(rule), changes.Added...) {
+		if removed[r] || seen[r] {
+			continue
+		}
+		seen[r] = true
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
@@ -0,0 +1,187 @@
+package generic
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		description   string
+		current       []string
+		desired       []string
+		expect        Changes
+		expectPending bool
+	}{
+		{
+			description: "in sync",
+			current:     []string{"1.1.1.1/32", "2.2.2.2/32"},
+			desired:     []string{"2.2.2.2/32", "1.1.1.1/32"},
+			expect: Changes{
+				Added:     []string{},
+				Removed:   []string{},
+				Unchanged: []string{"2.2.2.2/32", "1.1.1.1/32"},
+			},
+		},
+		{
+			description: "added and removed",
+			current:     []string{"1.1.1.1/32", "2.2.2.2/32"},
+			desired:     []string{"2.2.2.2/32", "3.3.3.3/32"},
+			expect: Changes{
+				Added:     []string{"3.3.3.3/32"},
+				Removed:   []string{"1.1.1.1/32"},
+				Unchanged: []string{"2.2.2.2/32"},
+			},
+			expectPending: true,
+		},
+		{
+			description: "provider formatting is not a change",
+			current:     []string{"1.1.1.1", "2001:DB8::1"},
+			desired:     []string{"1.1.1.1/32", "2001:db8::1/128"},
+			expect: Changes{
+				Added:     []string{},
+				Removed:   []string{},
+				Unchanged: []string{"1.1.1.1/32", "2001:db8::1/128"},
+			},
+		},
+		{
+			description: "empty firewall",
+			current:     nil,
+			desired:     []string{"1.1.1.1/32"},
+			expect: Changes{
+				Added:     []string{"1.1.1.1/32"},
+				Removed:   []string{},
+				Unchanged: []string{},
+			},
+			expectPending: true,
+		},
+		{
+			description: "duplicates are reported once",
+			current:     []string{"1.1.1.1/32", "1.1.1.1"},
+			desired:     []string{"2.2.2.2/32", "2.2.2.2/32"},
+			expect: Changes{
+				Added:     []string{"2.2.2.2/32"},
+				Removed:   []string{"1.1.1.1/32"},
+				Unchanged: []string{},
+			},
+			expectPending: true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			got := Diff(tc.current, tc.desired)
+			is.Equal(got, tc.expect)
+			is.Equal(got.Pending(), tc.expectPending)
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		description string
+		current     []string
+		owned       []string
+		desired     []string
+		expect      []string
+	}{
+		{
+			description: "foreign ranges are kept",
+			current:     []string{"10.0.0.0/8", "1.1.1.1/32"},
+			owned:       []string{"1.1.1.1/32"},
+			desired:     []string{"1.1.1.1/32", "2.2.2.2/32"},
+			expect:      []string{"10.0.0.0/8", "1.1.1.1/32", "2.2.2.2/32"},
+		},
+		{
+			description: "owned ranges no longer desired are removed",
+			current:     []string{"10.0.0.0/8", "1.1.1.1/32", "2.2.2.2/32"},
+			owned:       []string{"1.1.1.1/32", "2.2.2.2/32"},
+			desired:     []string{"2.2.2.2/32", "3.3.3.3/32"},
+			expect:      []string{"10.0.0.0/8", "2.2.2.2/32", "3.3.3.3/32"},
+		},
+		{
+			description: "nothing owned only adds",
+			current:     []string{"10.0.0.0/8", "1.1.1.1/32"},
+			owned:       nil,
+			desired:     []string{"2.2.2.2/32"},
+			expect:      []string{"10.0.0.0/8", "1.1.1.1/32", "2.2.2.2/32"},
+		},
+		{
+			description: "provider formatting is normalized",
+			current:     []string{"10.0.0.0/8", "1.1.1.1", "2001:DB8::1"},
+			owned:       []string{"1.1.1.1/32", "2001:db8::1/128"},
+			desired:     []string{"2001:db8::1/128"},
+			expect:      []string{"10.0.0.0/8", "2001:db8::1/128"},
+		},
+		{
+			description: "owned range removed outside of fwsync is not re-added unless desired",
+			current:     []string{"10.0.0.0/8"},
+			owned:       []string{"1.1.1.1/32"},
+			desired:     nil,
+			expect:      []string{"10.0.0.0/8"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(Merge(tc.current, tc.owned, tc.desired), tc.expect)
+		})
+	}
+}
+
+func TestRuleRanges(t *testing.T) {
+	// SSH allows the owned 1.1.1.1 and HTTPS is open to the world. Merging the union of both
+	// keeps 0.0.0.0/0, which must not end up on SSH.
+	previous := []string{"1.1.1.1/32", "0.0.0.0/0"}
+	desired := Merge(previous, []string{"1.1.1.1/32"}, []string{"2.2.2.2/32"})
+
+	tests := []struct {
+		description string
+		rule        []string
+		previous    []string
+		desired     []string
+		expect      []string
+	}{
+		{
+			description: "ranges of other rules are not copied",
+			rule:        []string{"1.1.1.1/32"},
+			previous:    previous,
+			desired:     desired,
+			expect:      []string{"2.2.2.2/32"},
+		},
+		{
+			description: "foreign ranges of the rule are kept",
+			rule:        []string{"0.0.0.0/0"},
+			previous:    previous,
+			desired:     desired,
+			expect:      []string{"0.0.0.0/0", "2.2.2.2/32"},
+		},
+		{
+			description: "single rule holds the desired ranges",
+			rule:        []string{"1.1.1.1/32", "10.0.0.0/8"},
+			previous:    []string{"1.1.1.1/32", "10.0.0.0/8"},
+			desired:     []string{"10.0.0.0/8", "2.2.2.2/32"},
+			expect:      []string{"10.0.0.0/8", "2.2.2.2/32"},
+		},
+		{
+			description: "provider formatting is normalized",
+			rule:        []string{"1.1.1.1", "2001:DB8::1"},
+			previous:    []string{"1.1.1.1", "2001:DB8::1", "0.0.0.0/0"},
+			desired:     []string{"0.0.0.0/0", "2001:db8::1/128"},
+			expect:      []string{"2001:db8::1/128"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(RuleRanges(tc.rule, tc.previous, tc.desired), tc.expect)
+		})
+	}
+}
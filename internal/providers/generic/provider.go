@@ -2,14 +2,31 @@ package generic
 
 import (
 	"context"
+	"errors"
 )
 
+// ErrConflict is returned by a ConditionalUpdater when the firewall was modified after it was read.
+var ErrConflict = errors.New("firewall was modified concurrently")
+
+// ErrNoRanges is returned instead of writing an empty list of source ranges, which providers treat inconsistently.
+var ErrNoRanges = errors.New("refusing to leave the firewall without source ranges")
+
 // Provider describes the behavior that a provider should implement in order to
 // be usable by fwsync.
 type Provider interface {
 	List(ctx context.Context) ([]Firewall, error)
 	Get(ctx context.Context, name string) (*Firewall, error)
 	Update(ctx context.Context, name string, sourceRanges []string) error
+	// AddressFormat declares how the provider expects the sourceRanges passed to Update to be written.
+	AddressFormat() AddressFormat
+}
+
+// ConditionalUpdater is implemented by providers that can reject an update when the firewall changed
+// since it was returned by Get. The provider stores whatever it needs to detect the change, e.g. a
+// fingerprint or etag, in the Firewall's Misc field. An error wrapping ErrConflict is returned when
+// the firewall was modified, callers are expected to Get the firewall again and retry.
+type ConditionalUpdater interface {
+	UpdateIfUnchanged(ctx context.Context, fw *Firewall, sourceRanges []string) error
 }
 
 // Firewall is a general type to represent a unique firewall from any provider implementing the Provider interface.
@@ -18,6 +35,11 @@ type Firewall struct {
 	Name string
 	// Allowed IPv4 Addresses
 	AllowedIPv4Addresses []string
+	// Allowed IPv6 Addresses
+	AllowedIPv6Addresses []string
+	// Names of the inbound rules on the firewall. Only set by providers where fwsync
+	// manages a single rule out of several on the same firewall.
+	Rules []string
 	// Misc key/value pair field. Any extra information needed by the Provider implementation to
 	// perform the basic firewall operations can be stored here.
 	Misc map[string]any
@@ -12,19 +12,22 @@ import (
 // Client is an implementation of generic.Provider for Akamai Linode.
 type Client struct {
 	conn *linodego.Client
+	rule string
 }
 
-// New returns a new Client.
-func New() (*Client, error) {
+// New returns a new Client. The rule is the label of the inbound ACCEPT rule managed by fwsync. When it
+// is empty, the first inbound ACCEPT rule of the firewall is managed.
+func New(rule string) (*Client, error) {
 	conn, err := linodego.NewClientFromEnv(http.DefaultClient)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Client{conn: conn}, nil
+	return &Client{conn: conn, rule: rule}, nil
 }
 
-// List will list all firewalls present in the account. It returns an unfiltered list of firewall names.
+// List will list all firewalls present in the account. It returns an unfiltered list of firewall names
+// along with the labels of their inbound ACCEPT rules.
 func (c Client) List(ctx context.Context) ([]generic.Firewall, error) {
 	fw, err := c.conn.ListFirewalls(ctx, nil)
 	if err != nil {
@@ -34,9 +37,23 @@ func (c Client) List(ctx context.Context) ([]generic.Firewall, error) {
 	// process firewalls
 	fws := make([]generic.Firewall, 0, len(fw))
 	for _, v := range fw {
+		labels := make([]string, 0, len(v.Rules.Inbound))
+		for _, rule := range v.Rules.Inbound {
+			if accepts(rule) {
+				labels = append(labels, rule.Label)
+			}
+		}
+
+		var addrs4, addrs6 []string
+		if idx, err := c.managedRule(v.Rules.Inbound); err == nil {
+			addrs4, addrs6 = addresses(v.Rules.Inbound[idx])
+		}
+
 		fws = append(fws, generic.Firewall{
 			Name:                 v.Label,
-			AllowedIPv4Addresses: *v.Rules.Inbound[0].Addresses.IPv4, // this is sketch since it may or may not exist at that index.
+			AllowedIPv4Addresses: addrs4,
+			AllowedIPv6Addresses: addrs6,
+			Rules:                labels,
 			Misc:                 map[string]any{"id": v.ID},
 		})
 	}
@@ -62,26 +79,23 @@ func (c Client) Get(ctx context.Context, name string) (*generic.Firewall, error)
 		return nil, fmt.Errorf("more than one firewall matching filter: label:%s AND is:firewall", name)
 	}
 
-	// doing a lot of extra bounds checking on nested slices here
-	// this ensures that we don't hit an out-of-bounds error or nil ptr dereference.
-	if len(fw[0].Rules.Inbound) == 0 {
-		return nil, fmt.Errorf("firewall: %s has no Inbound rules", fw[0].Label)
-	}
-
-	if fw[0].Rules.Inbound[0].Addresses.IPv4 == nil {
-		return nil, fmt.Errorf("firewall: %s has no IPv4 addresses configured", fw[0].Label)
+	idx, err := c.managedRule(fw[0].Rules.Inbound)
+	if err != nil {
+		return nil, fmt.Errorf("firewall: %s: %w", fw[0].Label, err)
 	}
 
-	addrs := *fw[0].Rules.Inbound[0].Addresses.IPv4
-
+	addrs4, addrs6 := addresses(fw[0].Rules.Inbound[idx])
 	return &generic.Firewall{
 		Name:                 fw[0].Label,
-		Misc:                 map[string]any{"id": fw[0].ID},
-		AllowedIPv4Addresses: addrs,
+		Misc:                 map[string]any{"id": fw[0].ID, "rule": fw[0].Rules.Inbound[idx].Label},
+		AllowedIPv4Addresses: addrs4,
+		AllowedIPv6Addresses: addrs6,
 	}, nil
 }
 
-// Update will update the given firewall rule with the provided IPs in sourceRanges.
+// Update will update the addresses of the managed inbound rule on the given firewall with the provided IPs in
+// sourceRanges. IPv4 and IPv6 ranges are written to their respective address lists. The current rule set is read
+// first so that all other rules, ports and policies are written back unchanged.
 func (c Client) Update(ctx context.Context, name string, sourceRanges []string) error {
 	// get the firewall by name
 	fw, err := c.Get(ctx, name)
@@ -94,19 +108,71 @@ func (c Client) Update(ctx context.Context, name string, sourceRanges []string)
 		return fmt.Errorf("no id found for firewall: %s", name)
 	}
 
-	_, err = c.conn.UpdateFirewallRules(ctx, id, linodego.FirewallRuleSet{
-		InboundPolicy:  "ACCEPT",
-		OutboundPolicy: "ACCEPT",
-		Inbound: []linodego.FirewallRule{
-			{
-				Action:   "ACCEPT",
-				Label:    fw.Name,
-				Protocol: "TCP",
-				Addresses: linodego.NetworkAddresses{
-					IPv4: &sourceRanges,
-				},
-			},
-		}})
+	rules, err := c.conn.GetFirewallRules(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	idx, err := c.managedRule(rules.Inbound)
+	if err != nil {
+		return fmt.Errorf("firewall: %s: %w", name, err)
+	}
 
+	ipv4, ipv6 := generic.SplitByFamily(sourceRanges)
+	rules.Inbound[idx].Addresses.IPv4 = &ipv4
+	rules.Inbound[idx].Addresses.IPv6 = &ipv6
+
+	_, err = c.conn.UpdateFirewallRules(ctx, id, *rules)
 	return err
 }
+
+// AddressFormat reports that Linode rule addresses are written in CIDR notation.
+func (c Client) AddressFormat() generic.AddressFormat {
+	return generic.FormatCIDR
+}
+
+// managedRule returns the index of the inbound rule managed by fwsync. DROP rules are never managed.
+func (c Client) managedRule(inbound []linodego.FirewallRule) (int, error) {
+	idx := -1
+	for i, rule := range inbound {
+		if !accepts(rule) {
+			continue
+		}
+		if c.rule == "" {
+			return i, nil
+		}
+		if rule.Label != c.rule {
+			continue
+		}
+		if idx != -1 {
+			return -1, fmt.Errorf("more than one Inbound rule labeled: %s", c.rule)
+		}
+		idx = i
+	}
+
+	if idx == -1 && c.rule == "" {
+		return -1, fmt.Errorf("no Inbound ACCEPT rules")
+	}
+	if idx == -1 {
+		return -1, fmt.Errorf("no Inbound ACCEPT rule labeled: %s", c.rule)
+	}
+
+	return idx, nil
+}
+
+// accepts reports whether the rule allows traffic, adding an IP to a DROP rule would block it.
+func accepts(rule linodego.FirewallRule) bool {
+	return rule.Action == "ACCEPT"
+}
+
+// addresses returns the IPv4 and IPv6 addresses of a rule.
+func addresses(rule linodego.FirewallRule) ([]string, []string) {
+	ipv4, ipv6 := []string{}, []string{}
+	if rule.Addresses.IPv4 != nil {
+		ipv4 = *rule.Addresses.IPv4
+	}
+	if rule.Addresses.IPv6 != nil {
+		ipv6 = *rule.Addresses.IPv6
+	}
+	return ipv4, ipv6
+}
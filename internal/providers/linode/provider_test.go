@@ -0,0 +1,192 @@
+package linode
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/linode/linodego"
+	"github.com/matryer/is"
+)
+
+func addrs(a ...string) *[]string {
+	return &a
+}
+
+func testRuleSet() linodego.FirewallRuleSet {
+	return linodego.FirewallRuleSet{
+		InboundPolicy: "DROP",
+		Inbound: []linodego.FirewallRule{
+			{Action: "ACCEPT", Label: "ssh", Ports: "22", Protocol: "TCP", Addresses: linodego.NetworkAddresses{IPv4: addrs("1.1.1.1/32")}},
+			{Action: "ACCEPT", Label: "https", Ports: "443", Protocol: "TCP", Addresses: linodego.NetworkAddresses{IPv4: addrs("0.0.0.0/0"), IPv6: addrs("::/0")}},
+		},
+		OutboundPolicy: "DROP",
+		Outbound: []linodego.FirewallRule{
+			{Action: "ACCEPT", Label: "dns", Ports: "53", Protocol: "UDP", Addresses: linodego.NetworkAddresses{IPv4: addrs("0.0.0.0/0")}},
+		},
+	}
+}
+
+// withDropRule returns the testRuleSet with a DROP rule in front of the ACCEPT rules.
+func withDropRule() linodego.FirewallRuleSet {
+	rules := testRuleSet()
+	drop := linodego.FirewallRule{
+		Action: "DROP", Label: "blocklist", Protocol: "TCP",
+		Addresses: linodego.NetworkAddresses{IPv4: addrs("6.6.6.6/32")},
+	}
+	rules.Inbound = append([]linodego.FirewallRule{drop}, rules.Inbound...)
+	return rules
+}
+
+// newTestClient returns a Client managing the given rule label, backed by a stand-in for the Linode API serving a
+// single firewall with the given rules. The rule set last written by the Client is available through the returned pointer.
+func newTestClient(t *testing.T, label string, rules linodego.FirewallRuleSet) (*Client, *linodego.FirewallRuleSet) {
+	written := &linodego.FirewallRuleSet{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v4/networking/firewalls", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"data":    []linodego.Firewall{{ID: 123, Label: "dev-vm", Rules: rules}},
+			"page":    1,
+			"pages":   1,
+			"results": 1,
+		})
+	})
+	mux.HandleFunc("GET /v4/networking/firewalls/123/rules", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(rules)
+	})
+	mux.HandleFunc("PUT /v4/networking/firewalls/123/rules", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(written); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(written)
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	conn := linodego.NewClient(srv.Client())
+	conn.SetBaseURL(srv.URL)
+	return &Client{conn: &conn, rule: label}, written
+}
+
+func TestClient_List(t *testing.T) {
+	tests := []struct {
+		description string
+		rules       linodego.FirewallRuleSet
+		expectRules []string
+		expectIPs   []string
+	}{
+		{
+			description: "firewall with inbound rules",
+			rules:       testRuleSet(),
+			expectRules: []string{"ssh", "https"},
+			expectIPs:   []string{"0.0.0.0/0", "::/0"},
+		},
+		{
+			description: "firewall without inbound rules",
+			rules:       linodego.FirewallRuleSet{InboundPolicy: "ACCEPT", OutboundPolicy: "ACCEPT"},
+			expectRules: []string{},
+		},
+		{
+			description: "drop rules are not listed",
+			rules:       withDropRule(),
+			expectRules: []string{"ssh", "https"},
+			expectIPs:   []string{"0.0.0.0/0", "::/0"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			client, _ := newTestClient(t, "https", tc.rules)
+
+			got, err := client.List(context.Background())
+			is.NoErr(err)
+			is.Equal(len(got), 1)
+			is.Equal(got[0].Rules, tc.expectRules)
+			is.Equal(append(got[0].AllowedIPv4Addresses, got[0].AllowedIPv6Addresses...), tc.expectIPs)
+		})
+	}
+}
+
+func TestClient_Get(t *testing.T) {
+	tests := []struct {
+		description string
+		label       string
+		rules       linodego.FirewallRuleSet
+		expectIPs   []string
+		expectErr   bool
+	}{
+		{
+			description: "no label manages first rule",
+			label:       "",
+			rules:       testRuleSet(),
+			expectIPs:   []string{"1.1.1.1/32"},
+		},
+		{
+			description: "label selects rule",
+			label:       "https",
+			rules:       testRuleSet(),
+			expectIPs:   []string{"0.0.0.0/0", "::/0"},
+		},
+		{
+			description: "label does not exist",
+			label:       "monitoring",
+			rules:       testRuleSet(),
+			expectErr:   true,
+		},
+		{
+			description: "no label skips drop rules",
+			label:       "",
+			rules:       withDropRule(),
+			expectIPs:   []string{"1.1.1.1/32"},
+		},
+		{
+			description: "label of a drop rule",
+			label:       "blocklist",
+			rules:       withDropRule(),
+			expectErr:   true,
+		},
+		{
+			description: "firewall without inbound rules",
+			label:       "ssh",
+			rules:       linodego.FirewallRuleSet{InboundPolicy: "ACCEPT", OutboundPolicy: "ACCEPT"},
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			is := is.New(t)
+			client, _ := newTestClient(t, tc.label, tc.rules)
+
+			got, err := client.Get(context.Background(), "dev-vm")
+			if tc.expectErr {
+				is.True(err != nil)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(append(got.AllowedIPv4Addresses, got.AllowedIPv6Addresses...), tc.expectIPs)
+		})
+	}
+}
+
+func TestClient_Update(t *testing.T) {
+	is := is.New(t)
+	client, written := newTestClient(t, "https", testRuleSet())
+
+	err := client.Update(context.Background(), "dev-vm", []string{"2.2.2.2/32", "2001:db8::1/128", "3.3.3.3/32"})
+	is.NoErr(err)
+
+	expected := testRuleSet()
+	expected.Inbound[1].Addresses.IPv4 = addrs("2.2.2.2/32", "3.3.3.3/32")
+	expected.Inbound[1].Addresses.IPv6 = addrs("2001:db8::1/128")
+	is.Equal(*written, expected) // only the managed rule's addresses change
+}
@@ -0,0 +1,172 @@
+// Package transaction updates firewalls from a snapshot of what they held. Sync updates a single firewall,
+// taking a new snapshot and retrying when the firewall was modified concurrently. Apply updates several
+// firewalls as a unit: every firewall is snapshotted before any of them is written, and if one fails to
+// update the firewalls updated before it are restored.
+package transaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jharshman/fwsync/internal/providers/generic"
+)
+
+// RollbackTimeout bounds restoring a single firewall to its snapshot. Rollbacks run even when
+// the context passed to Apply is done, since its deadline is a common reason for an update to fail.
+var RollbackTimeout = time.Minute
+
+// Target is a firewall to update as part of a transaction.
+type Target struct {
+	// Name identifies the target in reports, e.g. the profile it belongs to.
+	Name     string
+	Provider generic.Provider
+	// Firewall is the name of the firewall passed to the Provider.
+	Firewall string
+	// Ranges returns the source ranges to write, given the firewall's snapshot.
+	Ranges func(snapshot *generic.Firewall) []string
+}
+
+// Applied describes a target that was updated.
+type Applied struct {
+	Target string
+	// Previous holds the source ranges in the target's snapshot.
+	Previous []string
+	// Current holds the source ranges written to the target.
+	Current []string
+}
+
+// Rollback describes a target that was restored to its snapshot.
+type Rollback struct {
+	Target string
+	// Ranges the firewall was restored to.
+	Ranges []string
+	// Err is set if the firewall could not be restored.
+	Err error
+}
+
+// Error is returned by Apply when a target failed to update.
+type Error struct {
+	// Target that failed to update.
+	Target string
+	Err    error
+	// RolledBack holds the targets updated before Target, in the order they were restored.
+	RolledBack []Rollback
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("target: %s failed to update: %v", e.Target, e.Err)
+	if len(e.RolledBack) == 0 {
+		return msg
+	}
+
+	restored := make([]string, 0, len(e.RolledBack))
+	for _, r := range e.RolledBack {
+		if r.Err != nil {
+			restored = append(restored, fmt.Sprintf("%s (rollback failed: %v)", r.Target, r.Err))
+			continue
+		}
+		restored = append(restored, r.Target)
+	}
+	return fmt.Sprintf("%s, rolled back: %s", msg, strings.Join(restored, ", "))
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Apply snapshots every target with Provider.Get and then updates them in order. Nothing is written
+// if a snapshot fails. If an update fails, the targets updated before it are restored to their
+// snapshots in reverse order and an *Error describing the rollback is returned.
+// Providers implementing generic.ConditionalUpdater reject the update if the firewall changed since its snapshot.
+// On success the changes made to every target are returned.
+func Apply(ctx context.Context, targets []Target) ([]Applied, error) {
+	snapshots := make([]*generic.Firewall, len(targets))
+	for i, t := range targets {
+		fw, err := t.Provider.Get(ctx, t.Firewall)
+		if err != nil {
+			return nil, &Error{Target: t.Name, Err: fmt.Errorf("snapshot: %w", err)}
+		}
+		snapshots[i] = fw
+	}
+
+	applied := make([]Applied, 0, len(targets))
+	for i, t := range targets {
+		ranges := t.Ranges(snapshots[i])
+		if err := update(ctx, t, snapshots[i], ranges); err != nil {
+			return nil, &Error{Target: t.Name, Err: err, RolledBack: rollback(ctx, targets[:i], snapshots[:i])}
+		}
+		applied = append(applied, Applied{Target: t.Name, Previous: snapshotRanges(snapshots[i]), Current: ranges})
+	}
+	return applied, nil
+}
+
+// Sync snapshots the target with Provider.Get and updates it with the ranges computed from the snapshot.
+// Providers implementing generic.ConditionalUpdater reject the update if the firewall changed since its
+// snapshot, in which case a new snapshot is taken and the ranges are computed again, up to attempts times.
+// retrying is called before every new attempt and may be nil. On success the change made to the target is returned.
+func Sync(ctx context.Context, t Target, attempts int, retrying func()) (Applied, error) {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 && retrying != nil {
+			retrying()
+		}
+
+		var snapshot *generic.Firewall
+		snapshot, err = t.Provider.Get(ctx, t.Firewall)
+		if err != nil {
+			return Applied{}, err
+		}
+
+		ranges := t.Ranges(snapshot)
+		err = update(ctx, t, snapshot, ranges)
+		if err == nil {
+			return Applied{Target: t.Name, Previous: snapshotRanges(snapshot), Current: ranges}, nil
+		}
+		if !errors.Is(err, generic.ErrConflict) {
+			break
+		}
+	}
+	return Applied{}, err
+}
+
+// update writes the ranges to the target. An error wrapping generic.ErrNoRanges is returned if ranges is empty.
+func update(ctx context.Context, t Target, snapshot *generic.Firewall, ranges []string) error {
+	if len(ranges) == 0 {
+		return fmt.Errorf("firewall: %s: %w", t.Firewall, generic.ErrNoRanges)
+	}
+
+	ranges = generic.ToWire(ranges, t.Provider.AddressFormat())
+	if conditional, ok := t.Provider.(generic.ConditionalUpdater); ok {
+		return conditional.UpdateIfUnchanged(ctx, snapshot, ranges)
+	}
+	return t.Provider.Update(ctx, t.Firewall, ranges)
+}
+
+func snapshotRanges(snapshot *generic.Firewall) []string {
+	ranges := make([]string, 0, len(snapshot.AllowedIPv4Addresses)+len(snapshot.AllowedIPv6Addresses))
+	ranges = append(ranges, snapshot.AllowedIPv4Addresses...)
+	return append(ranges, snapshot.AllowedIPv6Addresses...)
+}
+
+// rollback restores the targets to their snapshots, last target first. Snapshots without ranges can't be restored.
+func rollback(ctx context.Context, targets []Target, snapshots []*generic.Firewall) []Rollback {
+	rolledBack := make([]Rollback, 0, len(targets))
+	for i := len(targets) - 1; i >= 0; i-- {
+		t, ranges := targets[i], snapshotRanges(snapshots[i])
+
+		if len(ranges) == 0 {
+			rolledBack = append(rolledBack, Rollback{Target: t.Name, Ranges: ranges, Err: generic.ErrNoRanges})
+			continue
+		}
+
+		rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), RollbackTimeout)
+		err := t.Provider.Update(rctx, t.Firewall, generic.ToWire(ranges, t.Provider.AddressFormat()))
+		cancel()
+
+		rolledBack = append(rolledBack, Rollback{Target: t.Name, Ranges: ranges, Err: err})
+	}
+	return rolledBack
+}
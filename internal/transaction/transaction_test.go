@@ -0,0 +1,258 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jharshman/fwsync/internal/providers/generic"
+	"github.com/matryer/is"
+)
+
+// fakeProvider holds firewalls in memory. Updates to the firewalls in fail return an error.
+type fakeProvider struct {
+	firewalls map[string][]string
+	fail      map[string]bool
+	updates   []string
+}
+
+func (f *fakeProvider) List(ctx context.Context) ([]generic.Firewall, error) {
+	return nil, nil
+}
+
+func (f *fakeProvider) Get(ctx context.Context, name string) (*generic.Firewall, error) {
+	ranges, ok := f.firewalls[name]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	ipv4, ipv6 := generic.SplitByFamily(ranges)
+	return &generic.Firewall{Name: name, AllowedIPv4Addresses: ipv4, AllowedIPv6Addresses: ipv6}, nil
+}
+
+func (f *fakeProvider) Update(ctx context.Context, name string, sourceRanges []string) error {
+	f.updates = append(f.updates, name)
+	if f.fail[name] {
+		return errors.New("update failed")
+	}
+	f.firewalls[name] = sourceRanges
+	return nil
+}
+
+func (f *fakeProvider) AddressFormat() generic.AddressFormat {
+	return generic.FormatCIDR
+}
+
+func newFake() *fakeProvider {
+	return &fakeProvider{
+		firewalls: map[string][]string{
+			"ssh":   {"1.1.1.1/32"},
+			"https": {"1.1.1.1/32", "2001:db8::1/128"},
+			"admin": {"1.1.1.1/32"},
+		},
+		fail: map[string]bool{},
+	}
+}
+
+func targets(provider generic.Provider, names ...string) []Target {
+	out := make([]Target, 0, len(names))
+	for _, name := range names {
+		out = append(out, Target{
+			Name:     "profile-" + name,
+			Provider: provider,
+			Firewall: name,
+			Ranges: func(snapshot *generic.Firewall) []string {
+				return []string{"2.2.2.2/32"}
+			},
+		})
+	}
+	return out
+}
+
+func TestApply(t *testing.T) {
+	is := is.New(t)
+	fake := newFake()
+
+	applied, err := Apply(context.Background(), targets(fake, "ssh", "https"))
+	is.NoErr(err)
+	is.Equal(applied, []Applied{
+		{Target: "profile-ssh", Previous: []string{"1.1.1.1/32"}, Current: []string{"2.2.2.2/32"}},
+		{Target: "profile-https", Previous: []string{"1.1.1.1/32", "2001:db8::1/128"}, Current: []string{"2.2.2.2/32"}},
+	})
+	is.Equal(fake.firewalls["ssh"], []string{"2.2.2.2/32"})
+	is.Equal(fake.firewalls["https"], []string{"2.2.2.2/32"})
+}
+
+func TestApply_Rollback(t *testing.T) {
+	is := is.New(t)
+	fake := newFake()
+	fake.fail["admin"] = true
+
+	_, err := Apply(context.Background(), targets(fake, "ssh", "https", "admin"))
+
+	var txErr *Error
+	is.True(errors.As(err, &txErr))
+	is.Equal(txErr.Target, "profile-admin")
+	is.Equal(txErr.RolledBack, []Rollback{
+		{Target: "profile-https", Ranges: []string{"1.1.1.1/32", "2001:db8::1/128"}},
+		{Target: "profile-ssh", Ranges: []string{"1.1.1.1/32"}},
+	})
+	is.Equal(err.Error(), "target: profile-admin failed to update: update failed, rolled back: profile-https, profile-ssh")
+
+	// every firewall is back to its snapshot.
+	is.Equal(fake.firewalls["ssh"], []string{"1.1.1.1/32"})
+	is.Equal(fake.firewalls["https"], []string{"1.1.1.1/32", "2001:db8::1/128"})
+	is.Equal(fake.firewalls["admin"], []string{"1.1.1.1/32"})
+	is.Equal(fake.updates, []string{"ssh", "https", "admin", "https", "ssh"})
+}
+
+func TestApply_RollbackFailure(t *testing.T) {
+	is := is.New(t)
+	fake := newFake()
+	fake.fail["https"] = true
+
+	tgts := targets(fake, "ssh", "https")
+	tgts[1].Ranges = func(snapshot *generic.Firewall) []string {
+		fake.fail["ssh"] = true // ssh can no longer be written once https is attempted.
+		return []string{"2.2.2.2/32"}
+	}
+
+	_, err := Apply(context.Background(), tgts)
+
+	var txErr *Error
+	is.True(errors.As(err, &txErr))
+	is.Equal(len(txErr.RolledBack), 1)
+	is.True(txErr.RolledBack[0].Err != nil)
+	is.Equal(err.Error(), "target: profile-https failed to update: update failed, rolled back: profile-ssh (rollback failed: update failed)")
+	is.Equal(fake.firewalls["ssh"], []string{"2.2.2.2/32"}) // left as updated
+}
+
+func TestApply_NoRanges(t *testing.T) {
+	is := is.New(t)
+	fake := newFake()
+
+	tgts := targets(fake, "ssh", "https")
+	tgts[1].Ranges = func(snapshot *generic.Firewall) []string {
+		return nil // e.g. the last IP was revoked
+	}
+
+	_, err := Apply(context.Background(), tgts)
+	is.True(errors.Is(err, generic.ErrNoRanges))
+	is.Equal(fake.updates, []string{"ssh", "ssh"}) // https is never written, ssh is rolled back
+	is.Equal(fake.firewalls["https"], []string{"1.1.1.1/32", "2001:db8::1/128"})
+	is.Equal(fake.firewalls["ssh"], []string{"1.1.1.1/32"})
+}
+
+func TestApply_SnapshotFailure(t *testing.T) {
+	is := is.New(t)
+	fake := newFake()
+
+	_, err := Apply(context.Background(), targets(fake, "ssh", "missing"))
+
+	var txErr *Error
+	is.True(errors.As(err, &txErr))
+	is.Equal(txErr.Target, "profile-missing")
+	is.Equal(len(fake.updates), 0) // nothing is written
+}
+
+// conditionalProvider versions its firewalls and rejects updates based on an outdated snapshot.
+// modify is called after every Get and may change the firewall, as someone editing it concurrently would.
+type conditionalProvider struct {
+	*fakeProvider
+	version map[string]int
+	gets    int
+	modify  func(name string)
+}
+
+func (f *conditionalProvider) Get(ctx context.Context, name string) (*generic.Firewall, error) {
+	fw, err := f.fakeProvider.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	f.gets++
+	fw.Misc = map[string]any{"version": f.version[name]}
+	if f.modify != nil {
+		f.modify(name)
+	}
+	return fw, nil
+}
+
+func (f *conditionalProvider) UpdateIfUnchanged(ctx context.Context, fw *generic.Firewall, sourceRanges []string) error {
+	if fw.Misc["version"] != f.version[fw.Name] {
+		return generic.ErrConflict
+	}
+	f.version[fw.Name]++
+	return f.Update(ctx, fw.Name, sourceRanges)
+}
+
+// merging returns a target replacing the owned 1.1.1.1 with 2.2.2.2 while keeping every other range.
+func merging(provider generic.Provider, name string) Target {
+	return Target{
+		Name:     "profile-" + name,
+		Provider: provider,
+		Firewall: name,
+		Ranges: func(snapshot *generic.Firewall) []string {
+			return generic.Merge(snapshotRanges(snapshot), []string{"1.1.1.1/32"}, []string{"2.2.2.2/32"})
+		},
+	}
+}
+
+func TestSync(t *testing.T) {
+	is := is.New(t)
+	fake := &conditionalProvider{fakeProvider: newFake(), version: map[string]int{}}
+
+	retries := 0
+	applied, err := Sync(context.Background(), merging(fake, "ssh"), 3, func() { retries++ })
+	is.NoErr(err)
+	is.Equal(applied, Applied{Target: "profile-ssh", Previous: []string{"1.1.1.1/32"}, Current: []string{"2.2.2.2/32"}})
+	is.Equal(fake.firewalls["ssh"], []string{"2.2.2.2/32"})
+	is.Equal(retries, 0)
+}
+
+func TestSync_Conflict(t *testing.T) {
+	is := is.New(t)
+	fake := &conditionalProvider{fakeProvider: newFake(), version: map[string]int{}}
+	// 10.0.0.0/8 is added right after the first snapshot is taken.
+	fake.modify = func(name string) {
+		if fake.gets == 1 {
+			fake.firewalls[name] = append(fake.firewalls[name], "10.0.0.0/8")
+			fake.version[name]++
+		}
+	}
+
+	retries := 0
+	applied, err := Sync(context.Background(), merging(fake, "ssh"), 3, func() { retries++ })
+	is.NoErr(err)
+	is.Equal(retries, 1)
+	is.Equal(fake.gets, 2)                  // the firewall is read again before retrying
+	is.Equal(fake.updates, []string{"ssh"}) // the outdated merge is never written
+	// the merge is computed again from the second snapshot, so the concurrent change is kept.
+	is.Equal(applied.Previous, []string{"1.1.1.1/32", "10.0.0.0/8"})
+	is.Equal(fake.firewalls["ssh"], []string{"10.0.0.0/8", "2.2.2.2/32"})
+}
+
+func TestSync_ConflictPersists(t *testing.T) {
+	is := is.New(t)
+	fake := &conditionalProvider{fakeProvider: newFake(), version: map[string]int{}}
+	fake.modify = func(name string) { fake.version[name]++ }
+
+	_, err := Sync(context.Background(), merging(fake, "ssh"), 3, nil)
+	is.True(errors.Is(err, generic.ErrConflict))
+	is.Equal(fake.gets, 3)
+	is.Equal(len(fake.updates), 0)
+	is.Equal(fake.firewalls["ssh"], []string{"1.1.1.1/32"})
+}
+
+func TestSync_NoRanges(t *testing.T) {
+	is := is.New(t)
+	fake := &conditionalProvider{fakeProvider: newFake(), version: map[string]int{}}
+
+	target := merging(fake, "ssh")
+	target.Ranges = func(snapshot *generic.Firewall) []string {
+		return generic.Merge(snapshotRanges(snapshot), []string{"1.1.1.1/32"}, nil)
+	}
+
+	_, err := Sync(context.Background(), target, 3, nil)
+	is.True(errors.Is(err, generic.ErrNoRanges))
+	is.Equal(len(fake.updates), 0)
+	is.Equal(fake.firewalls["ssh"], []string{"1.1.1.1/32"})
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -41,10 +42,23 @@ connecting from and keeps your development VM firewall rule up to date with that
 	rootCmd.AddCommand(cmd.Update())
 	rootCmd.AddCommand(cmd.List())
 	rootCmd.AddCommand(cmd.Sync())
+	rootCmd.AddCommand(cmd.Plan())
+	rootCmd.AddCommand(cmd.Status())
+	rootCmd.AddCommand(cmd.History())
+	rootCmd.AddCommand(cmd.Rollback())
+	rootCmd.AddCommand(cmd.Prune())
+	rootCmd.AddCommand(cmd.Allow())
+	rootCmd.AddCommand(cmd.Revoke())
+	rootCmd.AddCommand(cmd.Pin())
+	rootCmd.AddCommand(cmd.Unpin())
 	rootCmd.AddCommand(cmd.GetCurrentIP())
 	rootCmd.AddCommand(versionCmd)
 
 	if err := rootCmd.Execute(); err != nil {
+		var exitErr *cmd.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		fmt.Fprintf(os.Stderr, "Error running command: %q\n", err)
 		os.Exit(1)
 	}